@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/spf13/viper"
+)
+
+// runCrawl analyzes the seed user and its top counterparts hop by hop and
+// writes the edges of the resulting ego network as CSV, or with -rank the
+// users ranked by the given mode. Progress is kept in the checkpoint file, an
+// interrupted crawl continues where it stopped when run again.
+//
+//	crawl [-user id] [-depth 2] [-breadth 10] [-checkpoint crawl.json] [-rank pagerank]
+func runCrawl(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	userId := fs.String("user", seedUserId, "seed user id")
+	depth := fs.Int("depth", 2, "hops from the seed covered by the network")
+	breadth := fs.Int("breadth", 10, "top counterparts of every analyzed user crawled next")
+	checkpoint := fs.String("checkpoint", viper.GetString("TWITTER_CRAWL_CHECKPOINT"), "crawl progress file")
+	rank := fs.String("rank", "", "rank users by interactions, pagerank, in-degree, out-degree, betweenness or eigenvector instead of writing edges")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *depth < 1 || *breadth < 0 {
+		return fmt.Errorf("-depth must be positive and -breadth not negative")
+	}
+	if *rank != "" && !slices.Contains(twitter.RankingModes, twitter.RankingMode(*rank)) {
+		return fmt.Errorf("unknown ranking mode %q", *rank)
+	}
+
+	client, err := buildClient()
+	if err != nil {
+		return fmt.Errorf("creating twitter client: %w", err)
+	}
+	crawler := twitter.NewCrawler(newAnalyzer(client, client))
+	crawler.Depth = *depth
+	crawler.Breadth = *breadth
+	crawler.CheckpointPath = *checkpoint
+
+	// Interrupt stops the crawl after the user being analyzed. Rate limit
+	// waits of that user can take minutes, a second interrupt exits
+	// immediately, the checkpoint keeps the users analyzed before.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			signal.Stop(interrupt)
+			slog.Warn("interrupted, stopping after the user being analyzed, interrupt again to exit immediately")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	result, err := crawler.Crawl(ctx, *userId)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(out)
+	if *rank != "" {
+		return writeRanking(cw, result.Graph, twitter.RankingMode(*rank))
+	}
+	if err := cw.Write([]string{"from", "to", "kind", "count"}); err != nil {
+		return err
+	}
+	for _, e := range result.Graph.Edges() {
+		if err := cw.Write([]string{e.From, e.To, string(e.Kind), strconv.FormatUint(uint64(e.Count), 10)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeRanking writes the users of g ranked by mode as CSV
+func writeRanking(cw *csv.Writer, g *twitter.Graph, mode twitter.RankingMode) error {
+	userIds, scores, err := g.Ranked(mode)
+	if err != nil {
+		return err
+	}
+	if err := cw.Write([]string{"rank", "user_id", "username", "score"}); err != nil {
+		return err
+	}
+	for i, id := range userIds {
+		err := cw.Write([]string{
+			strconv.Itoa(i + 1), id, g.Node(id).Username, strconv.FormatFloat(scores[i], 'g', 6, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
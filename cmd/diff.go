@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/store"
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/spf13/viper"
+)
+
+// runDiff prints who moved up or dropped off the ranking between two stored
+// runs. By default the latest run of the user is compared to the latest run
+// finished a week before it.
+//
+//	diff [-store runs.db] [-user id] [-since 168h] [-from run id] [-to run id] [-format table|json]
+func runDiff(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	storePath := fs.String("store", viper.GetString("TWITTER_STORE_PATH"), "run store database file")
+	userId := fs.String("user", seedUserId, "analyzed user id")
+	since := fs.Duration("since", time.Hour*24*7, "compare with the run finished this long before the newer run")
+	fromId := fs.Uint64("from", 0, "older run id, overrides -since")
+	toId := fs.Uint64("to", 0, "newer run id, latest run of the user by default")
+	format := fs.String("format", "table", "output format, table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *storePath == "" {
+		return fmt.Errorf("missing -store or TWITTER_STORE_PATH")
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	s, err := store.OpenBoltStore(*storePath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	newer, err := s.LatestRun(*userId)
+	if *toId != 0 {
+		newer, err = s.GetRun(*toId)
+	}
+	if err != nil {
+		return fmt.Errorf("newer run: %w", err)
+	}
+	older, err := s.RunBefore(newer.UserId, newer.FinishedAt.Add(-*since))
+	if *fromId != 0 {
+		older, err = s.GetRun(*fromId)
+	}
+	if err != nil {
+		return fmt.Errorf("older run: %w", err)
+	}
+	if older.Id == newer.Id {
+		return fmt.Errorf("run #%d is compared to itself", newer.Id)
+	}
+	if older.UserId != newer.UserId {
+		return fmt.Errorf("run #%d of user %s and run #%d of user %s analyze different users", older.Id, older.UserId, newer.Id, newer.UserId)
+	}
+
+	diff := twitter.DiffInteractions(older.Interactions, newer.Interactions)
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]any{
+			"older_run_id": older.Id,
+			"newer_run_id": newer.Id,
+			"diff":         diff,
+		})
+	}
+
+	fmt.Fprintf(out, "Run #%d (%s) -> run #%d (%s)\n\n", older.Id, older.FinishedAt.Format(time.DateTime), newer.Id, newer.FinishedAt.Format(time.DateTime))
+	printRankChanges(out, "New entrants", diff.NewEntrants)
+	printRankChanges(out, "Moved", diff.Changed)
+	printRankChanges(out, "Dropped off", diff.Dropouts)
+	return nil
+}
+
+func printRankChanges(out io.Writer, title string, changes []twitter.RankChange) {
+	fmt.Fprintf(out, "%s (%d)\n", title, len(changes))
+	if len(changes) == 0 {
+		fmt.Fprintln(out)
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER ID\tUSERNAME\tRANK\tDELTA\tINTERACTIONS\tREPLIES\tRETWEETS\tLIKES")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s -> %s\t%s\t%d -> %d\t%s\t%s\t%s\n",
+			c.UserId, c.Username,
+			rankString(c.OldRank), rankString(c.NewRank), signed(c.RankDelta),
+			c.OldInteractions, c.NewInteractions,
+			signed(c.Deltas.Replies), signed(c.Deltas.Retweets), signed(c.Deltas.Likes),
+		)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+}
+
+func rankString(rank int) string {
+	if rank == 0 {
+		return "-"
+	}
+	return "#" + strconv.Itoa(rank)
+}
+
+func signed(n int) string {
+	if n > 0 {
+		return "+" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/store"
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.db")
+	s, err := store.OpenBoltStore(path)
+	require.NoError(t, err)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, userId := range []string{"1", "1", "2"} {
+		u := twitter.NewUserInteractionsObject()
+		u.UserTwitterId = userId
+		u.RepliesToOtherUsers["3"] = uint(i + 1)
+		at := start.Add(time.Hour * 24 * time.Duration(i))
+		require.NoError(t, s.SaveRun(store.NewRun(u, store.RunParams{}, at, at)))
+	}
+	require.NoError(t, s.Close())
+
+	tests := []struct {
+		name     string
+		from, to uint64
+		wantErr  string
+	}{
+		{name: "runs of the same user", from: 1, to: 2},
+		{name: "same run", from: 2, to: 2, wantErr: "run #2 is compared to itself"},
+		{name: "different users", from: 1, to: 3, wantErr: "run #1 of user 1 and run #3 of user 2 analyze different users"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := runDiff([]string{"-store", path, "-from", fmt.Sprint(tc.from), "-to", fmt.Sprint(tc.to)}, out)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				assert.Contains(t, out.String(), "Run #1")
+			} else {
+				assert.EqualError(t, err, tc.wantErr)
+			}
+		})
+	}
+
+	// A zero -since window finds the newer run itself
+	err = runDiff([]string{"-store", path, "-user", "2", "-since", "0s"}, &bytes.Buffer{})
+	assert.EqualError(t, err, "run #3 is compared to itself")
+}
@@ -1,53 +1,345 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/D8-X/twitter-counter/src/store"
 	"github.com/D8-X/twitter-counter/src/twitter"
 	"github.com/spf13/viper"
 )
 
-// Example usage of twitter social graph ranking
+// d8x_exchange user id
+const seedUserId = "1593204306206932993"
+
+// Example usage of twitter social graph ranking. Run with "diff" argument to
+// compare stored runs, see runDiff, with "series" argument to export
+// interaction time series from the archive, see runSeries, or with "crawl"
+// argument to crawl the ego network, see runCrawl.
 func main() {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource: true,
 	})))
 
+	loadConfig()
+
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := runDiff(os.Args[2:], os.Stdout); err != nil {
+			slog.Error("diffing runs", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "series" {
+		if err := runSeries(os.Args[2:], os.Stdout); err != nil {
+			slog.Error("exporting time series", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "crawl" {
+		if err := runCrawl(os.Args[2:], os.Stdout); err != nil {
+			slog.Error("crawling ego network", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	runInteractionsAnalyzer()
 }
 
-func runInteractionsAnalyzer() {
+func loadConfig() {
 	viper.SetConfigFile(".env")
 	if err := viper.ReadInConfig(); err != nil {
 		slog.Warn(".env file not found")
 	}
 
 	viper.AutomaticEnv()
+}
 
-	required := []string{
-		"TWITTER_AUTH_BEARER",
+func runInteractionsAnalyzer() {
+	// Build the Twitter client
+	client, err := buildClient()
+	if err != nil {
+		slog.Error("creating twitter client", slog.String("error", err.Error()))
+		os.Exit(1)
 	}
 
-	for _, e := range required {
-		if !viper.IsSet(e) {
-			slog.Error("missing required environment variable", slog.String("env", e))
+	// Filtered stream rules are kept in sync with the rules config
+	if path := viper.GetString("TWITTER_STREAM_RULES"); path != "" {
+		if err := syncStreamRules(client, path, viper.GetBool("TWITTER_STREAM_RULES_DRY_RUN")); err != nil {
+			slog.Error("syncing stream rules", slog.String("error", err.Error()))
 			os.Exit(1)
 		}
 	}
 
-	// Build the Twitter client
-	var client twitter.Client = twitter.NewAuthBearerClient(viper.GetString("TWITTER_AUTH_BEARER"))
+	// Repeated lookups are served from the on-disk cache
+	var cache *twitter.CachingClient
+	if dir := viper.GetString("TWITTER_CACHE_DIR"); dir != "" {
+		storage, err := twitter.NewDiskCache(dir)
+		if err != nil {
+			slog.Error("creating response cache", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		cache = twitter.NewCachingClient(client, storage, nil)
+	}
 
 	// Generate the user interaction graph
-	a := twitter.NewProductionAnalyzer(client)
-	// d8x_exchange user id
-	result, _ := a.CreateUserInteractionGraph("1593204306206932993")
+	var analyzerClient twitter.Client = client
+	if cache != nil {
+		analyzerClient = cache
+	}
+	// Raw pages are archived so that interactions can be rebuilt offline
+	if path := viper.GetString("TWITTER_ARCHIVE_PATH"); path != "" {
+		archive, err := twitter.CreateArchive(path)
+		if err != nil {
+			slog.Error("creating archive", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		defer archive.Close()
+		analyzerClient = twitter.NewArchivingClient(analyzerClient, archive)
+	}
+	a := newAnalyzer(client, analyzerClient)
+	startedAt := time.Now()
+	result, err := a.CreateUserInteractionGraph(seedUserId)
+	if err != nil {
+		// Interactions collected before the failure are still saved
+		slog.Error("analyzing user, results are incomplete", slog.String("error", err.Error()))
+	}
+
+	// Runs are persisted so that results can be compared over time
+	if path := viper.GetString("TWITTER_STORE_PATH"); path != "" {
+		if err := saveRun(path, store.NewRun(result, store.ParamsFromAnalyzer(a), startedAt, time.Now())); err != nil {
+			slog.Error("saving run", slog.String("error", err.Error()))
+		}
+	}
+
+	// Print out the ranked user ids, interaction counts, follower counts and
+	// likes of the interacted tweets
+	for i, u := range result.RankedUsers() {
+		followers := "-"
+		if u.Metrics != nil {
+			followers = strconv.FormatUint(uint64(u.Metrics.FollowersCount), 10)
+		}
+		tweetLikes := "-"
+		if u.TweetMetrics != nil {
+			tweetLikes = strconv.FormatUint(uint64(u.TweetMetrics.LikeCount), 10)
+		}
+		fmt.Printf("Rank #%d user id \t%s (@%s) number or interactions\t%d followers\t%s interacted tweet likes\t%s\n", i+1, u.UserId, u.Username, u.Interactions, followers, tweetLikes)
+	}
+
+	for reason, count := range result.SkippedReferences {
+		fmt.Printf("Skipped referenced tweets (%s)\t%d\n", reason, count)
+	}
+
+	if pool, ok := client.(*twitter.CredentialPool); ok {
+		for _, st := range pool.Stats() {
+			fmt.Printf("Credential %s requests\t%d rate limited\t%d errors\t%d\n", st.Name, st.Requests, st.RateLimited, st.Errors)
+		}
+	}
+
+	if cache != nil {
+		for endpoint, st := range cache.Stats() {
+			fmt.Printf("Cache %s hits\t%d misses\t%d\n", endpoint, st.Hits, st.Misses)
+		}
+	}
+}
+
+// newAnalyzer creates the production analyzer fetching through
+// analyzerClient, a decorator of client.
+func newAnalyzer(client, analyzerClient twitter.Client) *twitter.Analyzer {
+	a := twitter.NewProductionAnalyzer(analyzerClient)
+	// Pool limiters take care of per credential limits, analyzer limiters
+	// must allow the combined budget
+	if pool, ok := client.(*twitter.CredentialPool); ok {
+		a.TimelineLimiter = twitter.NewRateLimiter(75*pool.Size(), time.Minute*15)
+		a.LikedTweetsLimiter = twitter.NewRateLimiter(75*pool.Size(), time.Minute*15)
+	}
+	return a
+}
+
+// saveRun saves run to the store at path
+func saveRun(path string, run *store.Run) error {
+	s, err := store.OpenBoltStore(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.SaveRun(run); err != nil {
+		return err
+	}
+	fmt.Printf("Saved run #%d replies\t%d retweets\t%d likes\t%d\n", run.Id, run.Totals.Replies, run.Totals.Retweets, run.Totals.Likes)
+	return nil
+}
+
+// syncStreamRules applies the desired filtered stream rules from the json
+// config at path and prints the changes.
+func syncStreamRules(client twitter.Client, path string, dryRun bool) error {
+	sc, ok := client.(twitter.StreamClient)
+	if pool, isPool := client.(*twitter.CredentialPool); isPool {
+		sc, ok = pool.StreamClient()
+	}
+	if !ok {
+		return fmt.Errorf("client does not support filtered stream")
+	}
+	desired, err := twitter.LoadStreamRules(path)
+	if err != nil {
+		return err
+	}
+	result, err := twitter.NewRuleManager(sc).Sync(desired, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range result.Deleted {
+		fmt.Printf("Stream rule deleted\t%s\t%s\t%s\n", r.Id, r.Tag, r.Value)
+	}
+	for _, r := range result.Added {
+		fmt.Printf("Stream rule added\t%s\t%s\t%s\n", r.Id, r.Tag, r.Value)
+	}
+	if dryRun && result.Changed() {
+		fmt.Println("Dry run, stream rules were not changed")
+	}
+	return nil
+}
+
+// buildClient creates the twitter client from environment variables. OAuth 2.0
+// user context is used when TWITTER_OAUTH2_CLIENT_ID is set, otherwise app-only
+// authentication with either TWITTER_AUTH_BEARER or TWITTER_API_KEY and
+// TWITTER_API_SECRET is required. When TWITTER_ACCESS_TOKEN and
+// TWITTER_ACCESS_TOKEN_SECRET are set as well, requests are signed with OAuth
+// 1.0a in user context.
+func buildClient() (twitter.Client, error) {
+	opts, err := clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	// Replayed runs do not need credentials, responses come from the cassette
+	if viper.GetString("TWITTER_REPLAY_CASSETTE") != "" {
+		return twitter.NewAuthBearerClient("replay", opts...), nil
+	}
+
+	if viper.GetString("TWITTER_OAUTH2_CLIENT_ID") != "" {
+		return buildOAuth2UserClient(opts)
+	}
+
+	// Multiple comma separated bearer tokens are rotated in a credential pool
+	if bearers := viper.GetString("TWITTER_AUTH_BEARERS"); bearers != "" {
+		creds := []twitter.PooledCredential{}
+		for i, bearer := range strings.Split(bearers, ",") {
+			creds = append(creds, twitter.PooledCredential{
+				Name:     "bearer-" + strconv.Itoa(i+1),
+				Client:   twitter.NewAuthBearerClient(strings.TrimSpace(bearer), opts...),
+				Limiters: twitter.NewProLimiterSet(),
+			})
+		}
+		return twitter.NewCredentialPool(creds...), nil
+	}
 
-	// Print out the ranked user ids and interaction counts
-	rankedUserIds, rankedUserValues := result.Ranked()
-	for i, userId := range rankedUserIds {
-		fmt.Printf("Rank #%d user id \t%s number or interactions\t%d\n", i+1, userId, rankedUserValues[i])
+	if bearer := viper.GetString("TWITTER_AUTH_BEARER"); bearer != "" {
+		return twitter.NewAuthBearerClient(bearer, opts...), nil
+	}
+
+	apiKey, apiSecret := viper.GetString("TWITTER_API_KEY"), viper.GetString("TWITTER_API_SECRET")
+	accessToken, accessSecret := viper.GetString("TWITTER_ACCESS_TOKEN"), viper.GetString("TWITTER_ACCESS_TOKEN_SECRET")
+	// OAuth 1.0a user context when user access token is provided
+	if apiKey != "" && apiSecret != "" && accessToken != "" && accessSecret != "" {
+		return twitter.NewOAuth1Client(twitter.OAuth1Credentials{
+			ConsumerKey:       apiKey,
+			ConsumerSecret:    apiSecret,
+			AccessToken:       accessToken,
+			AccessTokenSecret: accessSecret,
+		}, opts...), nil
+	}
+	if apiKey != "" && apiSecret != "" {
+		return twitter.NewAppOnlyClient(apiKey, apiSecret, opts...), nil
+	}
+
+	return nil, fmt.Errorf("missing required environment variables: TWITTER_AUTH_BEARER or TWITTER_API_KEY and TWITTER_API_SECRET")
+}
+
+// buildOAuth2UserClient creates OAuth 2.0 user context client. When no token
+// is stored yet, the authorization url is printed and the local redirect
+// listener waits for the user to authorize the app.
+func buildOAuth2UserClient(opts []twitter.ClientOption) (twitter.Client, error) {
+	viper.SetDefault("TWITTER_OAUTH2_REDIRECT_URL", "http://127.0.0.1:8765/callback")
+	viper.SetDefault("TWITTER_OAUTH2_TOKEN_FILE", ".twitter-token.json")
+
+	cfg := twitter.OAuth2Config{
+		ClientID:     viper.GetString("TWITTER_OAUTH2_CLIENT_ID"),
+		ClientSecret: viper.GetString("TWITTER_OAUTH2_CLIENT_SECRET"),
+		RedirectURL:  viper.GetString("TWITTER_OAUTH2_REDIRECT_URL"),
+		Scopes:       []string{"tweet.read", "users.read", "like.read", "offline.access"},
+	}
+	store := &twitter.FileTokenStore{Path: viper.GetString("TWITTER_OAUTH2_TOKEN_FILE")}
+
+	token, err := store.LoadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+		defer cancel()
+
+		_, err := twitter.AuthorizeWithLocalRedirect(ctx, cfg, store, func(authURL string) error {
+			fmt.Printf("Open the following url in your browser to authorize the app:\n\n%s\n\n", authURL)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := twitter.NewOAuth2UserClient(cfg, store, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// clientOptions collects optional http client configuration from environment
+// variables. TWITTER_RECORD_CASSETTE records all API traffic to a cassette file,
+// TWITTER_REPLAY_CASSETTE serves responses from a recorded cassette offline.
+func clientOptions() ([]twitter.ClientOption, error) {
+	opts := []twitter.ClientOption{}
+	if baseURL := viper.GetString("TWITTER_API_BASE_URL"); baseURL != "" {
+		opts = append(opts, twitter.WithBaseURL(baseURL))
+	}
+	if timeout := viper.GetDuration("TWITTER_TIMEOUT"); timeout > 0 {
+		opts = append(opts, twitter.WithTimeout(timeout))
+	}
+	if userAgent := viper.GetString("TWITTER_USER_AGENT"); userAgent != "" {
+		opts = append(opts, twitter.WithUserAgent(userAgent))
+	}
+	// Replayed requests do not reach the network and ignore the proxy, the
+	// recorder sends requests through it
+	proxy := viper.GetString("TWITTER_PROXY")
+	if path := viper.GetString("TWITTER_REPLAY_CASSETTE"); path != "" {
+		replay, err := twitter.NewReplayTransportFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, twitter.WithTransport(replay))
+	} else if path := viper.GetString("TWITTER_RECORD_CASSETTE"); path != "" {
+		recorder := twitter.NewRecordingTransport(path)
+		if proxy != "" {
+			transport, err := twitter.NewProxyTransport(proxy)
+			if err != nil {
+				return nil, err
+			}
+			recorder.Transport = transport
+		}
+		opts = append(opts, twitter.WithTransport(recorder))
+	} else if proxy != "" {
+		opts = append(opts, twitter.WithProxy(proxy))
 	}
+	return opts, nil
 }
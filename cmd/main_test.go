@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setConfig(t *testing.T, values map[string]string) {
+	for k, v := range values {
+		viper.Set(k, v)
+		t.Cleanup(func() { viper.Set(k, "") })
+	}
+}
+
+func TestClientOptionsProxyWhileRecording(t *testing.T) {
+	proxied := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Proxied requests carry the absolute url of the target
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte(`{"data":[{"id":"1","name":"Name","username":"user"}]}`))
+	}))
+	defer proxy.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	setConfig(t, map[string]string{
+		"TWITTER_API_BASE_URL":    "http://api.test/2/",
+		"TWITTER_PROXY":           proxy.URL,
+		"TWITTER_RECORD_CASSETTE": cassette,
+	})
+
+	opts, err := clientOptions()
+	require.NoError(t, err)
+	resp, err := twitter.NewAuthBearerClient("bearer", opts...).FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	assert.Len(t, resp.Data, 1)
+
+	require.Len(t, proxied, 1)
+	assert.Contains(t, proxied[0], "http://api.test/2/users/by")
+	recorded, err := twitter.LoadCassette(cassette)
+	require.NoError(t, err)
+	assert.Len(t, recorded.Interactions, 1)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/spf13/viper"
+)
+
+// runSeries writes the per counterpart interaction time series of the user,
+// rebuilt from the archive, as CSV. With -counterpart only the series of that
+// single pair is written.
+//
+//	series [-archive archive.jsonl.gz] [-user id] [-counterpart id] [-granularity daily|weekly] [-from 2024-01-01] [-to 2024-02-01]
+func runSeries(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("series", flag.ContinueOnError)
+	archivePath := fs.String("archive", viper.GetString("TWITTER_ARCHIVE_PATH"), "archive file written by the analyzer")
+	userId := fs.String("user", seedUserId, "analyzed user id")
+	counterpartId := fs.String("counterpart", "", "only write the series of this counterpart user id")
+	granularity := fs.String("granularity", string(twitter.Daily), "bucket size, daily or weekly")
+	fromDate := fs.String("from", "", "first day of the range, 30 days before -to by default")
+	toDate := fs.String("to", "", "day after the range, tomorrow by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *archivePath == "" {
+		return fmt.Errorf("missing -archive or TWITTER_ARCHIVE_PATH")
+	}
+	g := twitter.Granularity(*granularity)
+	if g != twitter.Daily && g != twitter.Weekly {
+		return fmt.Errorf("unknown granularity %q", *granularity)
+	}
+
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if *toDate != "" {
+		t, err := time.Parse(time.DateOnly, *toDate)
+		if err != nil {
+			return fmt.Errorf("parsing -to: %w", err)
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -30)
+	if *fromDate != "" {
+		t, err := time.Parse(time.DateOnly, *fromDate)
+		if err != nil {
+			return fmt.Errorf("parsing -from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("-from must be before -to")
+	}
+
+	f, err := os.Open(*archivePath)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+	events, err := twitter.ArchiveEvents(f, *userId)
+	if err != nil {
+		return err
+	}
+
+	series := twitter.InteractionEvents(events).Series(g, from, to)
+	if *counterpartId != "" {
+		series = map[string][]twitter.SeriesPoint{
+			*counterpartId: twitter.InteractionEvents(events).Pair(*userId, *counterpartId, g, from, to),
+		}
+	}
+	return twitter.WriteSeriesCSV(out, series)
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Run id -> json encoded Run
+	bucketRuns = []byte("runs")
+	// Nested bucket per user id, finished at + run id -> empty
+	bucketUserRuns = []byte("user_runs")
+)
+
+// BoltStore is a Store in a single bbolt database file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var _ Store = (*BoltStore)(nil)
+
+// OpenBoltStore opens or creates the database at path.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, fmt.Errorf("opening store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketRuns, bucketUserRuns} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating store buckets: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) SaveRun(run *Run) error {
+	if run.UserId == "" {
+		return fmt.Errorf("run has no user id")
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(bucketRuns)
+		id, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		saved := *run
+		saved.Id = id
+		data, err := json.Marshal(&saved)
+		if err != nil {
+			return fmt.Errorf("encoding run: %w", err)
+		}
+		if err := runs.Put(encodeId(id), data); err != nil {
+			return err
+		}
+
+		userRuns, err := tx.Bucket(bucketUserRuns).CreateBucketIfNotExists([]byte(run.UserId))
+		if err != nil {
+			return err
+		}
+		if err := userRuns.Put(userRunKey(run.FinishedAt, id), nil); err != nil {
+			return err
+		}
+
+		run.Id = id
+		return nil
+	})
+}
+
+func (s *BoltStore) GetRun(id uint64) (*Run, error) {
+	var ret *Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		run, err := getRun(tx, id)
+		ret = run
+		return err
+	})
+	return ret, err
+}
+
+func (s *BoltStore) LatestRun(userId string) (*Run, error) {
+	return s.RunBefore(userId, time.Time{})
+}
+
+func (s *BoltStore) RunBefore(userId string, at time.Time) (*Run, error) {
+	var ret *Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		userRuns := tx.Bucket(bucketUserRuns).Bucket([]byte(userId))
+		if userRuns == nil {
+			return ErrNotFound
+		}
+
+		c := userRuns.Cursor()
+		var k []byte
+		if at.IsZero() {
+			k, _ = c.Last()
+		} else {
+			// Seek positions after all runs finished at or before at
+			k, _ = c.Seek(userRunKey(at.Add(time.Nanosecond), 0))
+			if k == nil {
+				k, _ = c.Last()
+			} else {
+				k, _ = c.Prev()
+			}
+		}
+		if k == nil {
+			return ErrNotFound
+		}
+
+		run, err := getRun(tx, runIdFromKey(k))
+		ret = run
+		return err
+	})
+	return ret, err
+}
+
+func (s *BoltStore) PairHistory(userId, otherUserId string) ([]PairRecord, error) {
+	ret := []PairRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachUserRun(tx, userId, time.Time{}, func(run *Run) error {
+			ret = append(ret, PairRecord{
+				RunId:      run.Id,
+				FinishedAt: run.FinishedAt,
+				Counts:     PairCounts(run.Interactions, otherUserId),
+			})
+			return nil
+		})
+	})
+	return ret, err
+}
+
+func (s *BoltStore) LatestRuns(since time.Time) ([]*Run, error) {
+	ret := []*Run{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// Nested buckets are iterated in user id order
+		return tx.Bucket(bucketUserRuns).ForEach(func(userId, _ []byte) error {
+			var latest *Run
+			err := forEachUserRun(tx, string(userId), since, func(run *Run) error {
+				latest = run
+				return nil
+			})
+			if err == nil && latest != nil {
+				ret = append(ret, latest)
+			}
+			return err
+		})
+	})
+	return ret, err
+}
+
+func (s *BoltStore) TopN(n int, since time.Time) ([]TopUser, error) {
+	runs, err := s.LatestRuns(since)
+	if err != nil {
+		return nil, err
+	}
+
+	top := map[string]*TopUser{}
+	for _, run := range runs {
+		for _, u := range run.Interactions.RankedUsers() {
+			t, ok := top[u.UserId]
+			if !ok {
+				t = &TopUser{UserId: u.UserId}
+				top[u.UserId] = t
+			}
+			t.Interactions += u.Interactions
+			t.InteractedBy++
+			if u.Username != "" {
+				t.Username = u.Username
+			}
+		}
+	}
+
+	ret := make([]TopUser, 0, len(top))
+	for _, t := range top {
+		ret = append(ret, *t)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Interactions != ret[j].Interactions {
+			return ret[i].Interactions > ret[j].Interactions
+		}
+		return ret[i].UserId < ret[j].UserId
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret, nil
+}
+
+// forEachUserRun calls fn with the runs of userId finished at or after since,
+// oldest first
+func forEachUserRun(tx *bolt.Tx, userId string, since time.Time, fn func(*Run) error) error {
+	userRuns := tx.Bucket(bucketUserRuns).Bucket([]byte(userId))
+	if userRuns == nil {
+		return nil
+	}
+
+	c := userRuns.Cursor()
+	k, _ := c.First()
+	if !since.IsZero() {
+		k, _ = c.Seek(userRunKey(since, 0))
+	}
+	for ; k != nil; k, _ = c.Next() {
+		run, err := getRun(tx, runIdFromKey(k))
+		if err != nil {
+			return err
+		}
+		if err := fn(run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRun(tx *bolt.Tx, id uint64) (*Run, error) {
+	data := tx.Bucket(bucketRuns).Get(encodeId(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+
+	run := &Run{}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("decoding run %d: %w", id, err)
+	}
+	if run.Interactions == nil {
+		run.Interactions = twitter.NewUserInteractionsObject()
+	}
+	return run, nil
+}
+
+func encodeId(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// userRunKey orders runs of a user by finish time, runs finished at the same
+// time by id. Times before the unix epoch are not supported.
+func userRunKey(finishedAt time.Time, id uint64) []byte {
+	k := binary.BigEndian.AppendUint64(nil, uint64(max(finishedAt.UnixNano(), 0)))
+	return binary.BigEndian.AppendUint64(k, id)
+}
+
+func runIdFromKey(k []byte) uint64 {
+	return binary.BigEndian.Uint64(k[8:])
+}
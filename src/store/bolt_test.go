@@ -0,0 +1,203 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func interactions(userId string, replies, retweets, likes map[string]uint) *twitter.UserInteractions {
+	u := twitter.NewUserInteractionsObject()
+	u.UserTwitterId = userId
+	for k, v := range replies {
+		u.RepliesToOtherUsers[k] = v
+	}
+	for k, v := range retweets {
+		u.RetweetsToOtherUsers[k] = v
+	}
+	for k, v := range likes {
+		u.UserLikedTweets[k] = v
+	}
+	return u
+}
+
+func openTestStore(t *testing.T) (*BoltStore, string) {
+	path := filepath.Join(t.TempDir(), "runs.db")
+	s, err := OpenBoltStore(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestBoltStore(t *testing.T) {
+	s, path := openTestStore(t)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	params := RunParams{MaxTweetsPerRequest: 100, UserTweetsToFetch: 3200, UserLikedTweetsToFetch: 1000}
+
+	first := NewRun(interactions("1",
+		map[string]uint{"2": 3},
+		map[string]uint{"3": 1},
+		map[string]uint{"2": 1, "4": 5},
+	), params, start, start.Add(time.Minute))
+	first.Interactions.Usernames["4"] = "four"
+	assert.Equal(t, Counts{Replies: 3, Retweets: 1, Likes: 6}, first.Totals)
+
+	// Saved out of order, latest is determined by finish time
+	latest := NewRun(interactions("1",
+		map[string]uint{"2": 4},
+		nil,
+		map[string]uint{"4": 1},
+	), params, start.Add(time.Hour*48), start.Add(time.Hour*49))
+	middle := NewRun(interactions("1",
+		nil,
+		map[string]uint{"3": 2},
+		nil,
+	), params, start.Add(time.Hour*24), start.Add(time.Hour*25))
+	other := NewRun(interactions("5",
+		map[string]uint{"2": 2},
+		nil,
+		map[string]uint{"6": 1},
+	), params, start.Add(time.Hour*24), start.Add(time.Hour*24))
+
+	for _, run := range []*Run{first, latest, middle, other} {
+		require.NoError(t, s.SaveRun(run))
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4}, []uint64{first.Id, latest.Id, middle.Id, other.Id})
+
+	t.Run("latest run", func(t *testing.T) {
+		run, err := s.LatestRun("1")
+		require.NoError(t, err)
+		assert.Equal(t, latest.Id, run.Id)
+		assert.Equal(t, params, run.Params)
+		assert.True(t, latest.FinishedAt.Equal(run.FinishedAt))
+		assert.Equal(t, map[string]uint{"2": 4}, run.Interactions.RepliesToOtherUsers)
+
+		_, err = s.LatestRun("404")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("run before", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			at     time.Time
+			wantId uint64
+		}{
+			{"exactly at finish", middle.FinishedAt, middle.Id},
+			{"between runs", middle.FinishedAt.Add(time.Hour), middle.Id},
+			{"after all runs", latest.FinishedAt.Add(time.Hour * 100), latest.Id},
+			{"before all runs", first.FinishedAt.Add(-time.Nanosecond), 0},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				run, err := s.RunBefore("1", tc.at)
+				if tc.wantId == 0 {
+					assert.ErrorIs(t, err, ErrNotFound)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantId, run.Id)
+			})
+		}
+
+		run, err := s.GetRun(first.Id)
+		require.NoError(t, err)
+		assert.Equal(t, first.Totals, run.Totals)
+		_, err = s.GetRun(100)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("pair history", func(t *testing.T) {
+		history, err := s.PairHistory("1", "2")
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+		assert.Equal(t, []uint64{first.Id, middle.Id, latest.Id}, []uint64{history[0].RunId, history[1].RunId, history[2].RunId})
+		assert.Equal(t, Counts{Replies: 3, Likes: 1}, history[0].Counts)
+		assert.Equal(t, Counts{}, history[1].Counts)
+		assert.Equal(t, Counts{Replies: 4}, history[2].Counts)
+
+		history, err = s.PairHistory("404", "2")
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("latest runs", func(t *testing.T) {
+		runs, err := s.LatestRuns(time.Time{})
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+		assert.Equal(t, []uint64{latest.Id, other.Id}, []uint64{runs[0].Id, runs[1].Id})
+
+		runs, err = s.LatestRuns(start.Add(time.Hour * 30))
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, latest.Id, runs[0].Id)
+	})
+
+	t.Run("top n", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			n     int
+			since time.Time
+			want  []TopUser
+		}{
+			{
+				name: "latest runs only",
+				want: []TopUser{
+					{UserId: "2", Interactions: 6, InteractedBy: 2},
+					{UserId: "4", Interactions: 1, InteractedBy: 1},
+					{UserId: "6", Interactions: 1, InteractedBy: 1},
+				},
+			},
+			{
+				name: "limited",
+				n:    1,
+				want: []TopUser{{UserId: "2", Interactions: 6, InteractedBy: 2}},
+			},
+			{
+				name:  "window excludes older runs",
+				since: start.Add(time.Hour * 30),
+				want: []TopUser{
+					{UserId: "2", Interactions: 4, InteractedBy: 1},
+					{UserId: "4", Interactions: 1, InteractedBy: 1},
+				},
+			},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				top, err := s.TopN(tc.n, tc.since)
+				require.NoError(t, err)
+				assert.Equal(t, tc.want, top)
+			})
+		}
+	})
+
+	t.Run("persisted after reopen", func(t *testing.T) {
+		require.NoError(t, s.Close())
+		reopened, err := OpenBoltStore(path)
+		require.NoError(t, err)
+		defer reopened.Close()
+
+		run, err := reopened.LatestRun("5")
+		require.NoError(t, err)
+		assert.Equal(t, other.Id, run.Id)
+
+		next := NewRun(interactions("5", nil, nil, nil), params, start, start)
+		require.NoError(t, reopened.SaveRun(next))
+		assert.Equal(t, uint64(5), next.Id)
+	})
+}
+
+func TestBoltStoreUsernames(t *testing.T) {
+	s, _ := openTestStore(t)
+
+	run := NewRun(interactions("1", nil, nil, map[string]uint{"2": 1}), RunParams{}, time.Now(), time.Now())
+	run.Interactions.Usernames["2"] = "two"
+	require.NoError(t, s.SaveRun(run))
+
+	top, err := s.TopN(0, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []TopUser{{UserId: "2", Username: "two", Interactions: 1, InteractedBy: 1}}, top)
+}
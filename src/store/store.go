@@ -0,0 +1,137 @@
+// Package store persists interaction analysis runs so that results survive the
+// process and can be compared over time.
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+)
+
+// ErrNotFound is returned when no run matches the query.
+var ErrNotFound = errors.New("not found")
+
+// RunParams are the analyzer parameters a run was created with.
+type RunParams struct {
+	MaxTweetsPerRequest    uint `json:"max_tweets_per_request"`
+	UserTweetsToFetch      uint `json:"user_tweets_to_fetch"`
+	UserLikedTweetsToFetch uint `json:"user_liked_tweets_to_fetch"`
+}
+
+// ParamsFromAnalyzer returns the parameters of a.
+func ParamsFromAnalyzer(a *twitter.Analyzer) RunParams {
+	return RunParams{
+		MaxTweetsPerRequest:    a.MaxTweetsPerRequest,
+		UserTweetsToFetch:      a.UserTweetsToFetch,
+		UserLikedTweetsToFetch: a.UserLikedTweetsToFetch,
+	}
+}
+
+// Counts are interaction counts per category.
+type Counts struct {
+	Replies  uint `json:"replies"`
+	Retweets uint `json:"retweets"`
+	Likes    uint `json:"likes"`
+}
+
+// Total returns the sum of all categories.
+func (c Counts) Total() uint {
+	return c.Replies + c.Retweets + c.Likes
+}
+
+// PairCounts returns the counts of interactions of the analyzed user with
+// otherUserId.
+func PairCounts(u *twitter.UserInteractions, otherUserId string) Counts {
+	return Counts{
+		Replies:  u.RepliesToOtherUsers[otherUserId],
+		Retweets: u.RetweetsToOtherUsers[otherUserId],
+		Likes:    u.UserLikedTweets[otherUserId],
+	}
+}
+
+// Run is a single CreateUserInteractionGraph result.
+type Run struct {
+	// Id is assigned by Store.SaveRun
+	Id         uint64    `json:"id"`
+	UserId     string    `json:"user_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Params     RunParams `json:"params"`
+
+	// Totals per category over all interacted users
+	Totals Counts `json:"totals"`
+
+	Interactions *twitter.UserInteractions `json:"interactions"`
+}
+
+// NewRun creates a run of result. Totals are computed from result.
+func NewRun(result *twitter.UserInteractions, params RunParams, startedAt, finishedAt time.Time) *Run {
+	r := &Run{
+		UserId:       result.UserTwitterId,
+		StartedAt:    startedAt,
+		FinishedAt:   finishedAt,
+		Params:       params,
+		Interactions: result,
+	}
+	for _, n := range result.RepliesToOtherUsers {
+		r.Totals.Replies += n
+	}
+	for _, n := range result.RetweetsToOtherUsers {
+		r.Totals.Retweets += n
+	}
+	for _, n := range result.UserLikedTweets {
+		r.Totals.Likes += n
+	}
+	return r
+}
+
+// PairRecord are the interaction counts of a user pair in a single run.
+type PairRecord struct {
+	RunId      uint64    `json:"run_id"`
+	FinishedAt time.Time `json:"finished_at"`
+	Counts
+}
+
+// TopUser is an interacted user ranked across runs.
+type TopUser struct {
+	UserId       string
+	Username     string
+	Interactions uint
+	// Number of analyzed users which interacted with UserId
+	InteractedBy int
+}
+
+// Store persists runs. Implementations must be safe for concurrent use.
+type Store interface {
+	// SaveRun stores run and assigns its Id.
+	SaveRun(run *Run) error
+
+	// GetRun returns the run with id or ErrNotFound.
+	GetRun(id uint64) (*Run, error)
+
+	// LatestRun returns the most recently finished run of userId or
+	// ErrNotFound.
+	LatestRun(userId string) (*Run, error)
+
+	// RunBefore returns the latest run of userId finished at or before at,
+	// or ErrNotFound.
+	RunBefore(userId string, at time.Time) (*Run, error)
+
+	// PairHistory returns the interactions of userId with otherUserId in
+	// every run of userId, oldest first. Runs without interactions with
+	// otherUserId are included with zero counts.
+	PairHistory(userId, otherUserId string) ([]PairRecord, error)
+
+	// LatestRuns returns the latest run finished at or after since of every
+	// analyzed user, ordered by user id.
+	LatestRuns(since time.Time) ([]*Run, error)
+
+	// TopN returns the n most interacted users across the runs finished at
+	// or after since. Of each analyzed user only the latest run in the window
+	// is counted, so that overlapping timelines of repeated runs are not
+	// counted twice.
+	TopN(n int, since time.Time) ([]TopUser, error)
+
+	Close() error
+}
@@ -1,7 +1,10 @@
 package twitter
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"sort"
 	"strconv"
 	"sync"
@@ -24,8 +27,31 @@ type UserInteractions struct {
 	// Likes given by current UserTwtiterId. Key is other user id, Value is
 	// number of likes for that particular user id.
 	UserLikedTweets map[string]uint
+
+	// SkippedReferences counts referenced tweets which could not be
+	// attributed to an author. Key is the skip reason: the short problem type
+	// reported by the API (for example "resource-not-found" for deleted
+	// tweets) or SkipReasonMissingFromIncludes.
+	SkippedReferences map[string]uint
+
+	// UserMetrics are public metrics (follower counts) of the interacted
+	// users collected from the response includes. Key is the user id.
+	UserMetrics map[string]UserPublicMetrics
+
+	// TweetMetrics are the summed public metrics (engagement) of the other
+	// users' tweets which were retweeted, quoted or liked, a tweet is summed
+	// once per interaction. Key is the author user id.
+	TweetMetrics map[string]TweetPublicMetrics
+
+	// Usernames of the interacted users collected from the response includes.
+	// Key is the user id.
+	Usernames map[string]string
 }
 
+// SkipReasonMissingFromIncludes is used when referenced tweet is neither
+// included in the response nor reported in the response errors.
+const SkipReasonMissingFromIncludes = "missing-from-includes"
+
 // Ranked returns ranked list of user ids and their interaction values based on
 // given UserInteractions data. First returned slice is the user ids, second is
 // the interaction counts.
@@ -68,11 +94,67 @@ func (u *UserInteractions) Ranked() ([]string, []uint) {
 	return userIds, userValues
 }
 
+// RankedUser is a single entry of RankedUsers.
+type RankedUser struct {
+	UserId string
+	// Username is empty when the user was not included in any response
+	Username     string
+	Interactions uint
+
+	// Public metrics of the user, nil when they were not returned by the API
+	Metrics *UserPublicMetrics
+
+	// Summed public metrics of the interacted tweets of the user, nil when
+	// they were not returned by the API
+	TweetMetrics *TweetPublicMetrics
+}
+
+// RankedUsers returns users ranked by interaction counts like Ranked, together
+// with their usernames, public metrics and the engagement of their interacted
+// tweets.
+func (u *UserInteractions) RankedUsers() []RankedUser {
+	userIds, values := u.Ranked()
+
+	ret := make([]RankedUser, len(userIds))
+	for i, userId := range userIds {
+		ret[i] = RankedUser{
+			UserId:       userId,
+			Username:     u.Usernames[userId],
+			Interactions: values[i],
+		}
+		if m, ok := u.UserMetrics[userId]; ok {
+			ret[i].Metrics = &m
+		}
+		if m, ok := u.TweetMetrics[userId]; ok {
+			ret[i].TweetMetrics = &m
+		}
+	}
+	return ret
+}
+
+// Clone returns a deep copy of u.
+func (u *UserInteractions) Clone() *UserInteractions {
+	return &UserInteractions{
+		UserTwitterId:        u.UserTwitterId,
+		RepliesToOtherUsers:  maps.Clone(u.RepliesToOtherUsers),
+		RetweetsToOtherUsers: maps.Clone(u.RetweetsToOtherUsers),
+		UserLikedTweets:      maps.Clone(u.UserLikedTweets),
+		SkippedReferences:    maps.Clone(u.SkippedReferences),
+		UserMetrics:          maps.Clone(u.UserMetrics),
+		TweetMetrics:         maps.Clone(u.TweetMetrics),
+		Usernames:            maps.Clone(u.Usernames),
+	}
+}
+
 func NewUserInteractionsObject() *UserInteractions {
 	return &UserInteractions{
 		RepliesToOtherUsers:  map[string]uint{},
 		RetweetsToOtherUsers: map[string]uint{},
 		UserLikedTweets:      map[string]uint{},
+		SkippedReferences:    map[string]uint{},
+		UserMetrics:          map[string]UserPublicMetrics{},
+		TweetMetrics:         map[string]TweetPublicMetrics{},
+		Usernames:            map[string]string{},
 	}
 }
 
@@ -138,7 +220,11 @@ type Analyzer struct {
 // interactions from given r. These include: replies to other users, retweets of
 // other user tweets
 func (a *Analyzer) ProcessDirectUserInteractions(r *TweetsResponse, result *UserInteractions) {
-	for _, tweet := range r.Data {
+	collectIncludedUsers(r, result)
+
+	for i := range r.Data {
+		tweet := &r.Data[i]
+
 		// Process replies and increment reply counters. Replies contain
 		// InReplyToUserId field and can be used directly
 		if tweet.InReplyToUserId != "" {
@@ -156,9 +242,19 @@ func (a *Analyzer) ProcessDirectUserInteractions(r *TweetsResponse, result *User
 				// Find the referenced tweet from includes
 				originalTweet := r.FindReferencedTweet(referencedTweet.Id)
 				if originalTweet == nil {
+					reason := SkipReasonMissingFromIncludes
+					if pd := r.FindResourceError(referencedTweet.Id); pd != nil && pd.Type != "" {
+						reason = pd.ShortType()
+					}
+					if result.SkippedReferences == nil {
+						result.SkippedReferences = map[string]uint{}
+					}
+					result.SkippedReferences[reason]++
+
 					a.Logger.Warn("referenced tweet not found in includes",
 						slog.String("referenced_tweet_id", referencedTweet.Id),
 						slog.String("tweet_id", tweet.TweetId),
+						slog.String("reason", reason),
 					)
 					continue
 				}
@@ -168,19 +264,54 @@ func (a *Analyzer) ProcessDirectUserInteractions(r *TweetsResponse, result *User
 					result.RetweetsToOtherUsers[originalTweet.AuthorUserId] = 0
 				}
 				result.RetweetsToOtherUsers[originalTweet.AuthorUserId]++
+				addTweetMetrics(originalTweet, result)
 			}
 		}
 	}
 }
 
+// collectIncludedUsers stores usernames and public metrics of included users
+func collectIncludedUsers(r *TweetsResponse, result *UserInteractions) {
+	for _, u := range r.Includes.Users {
+		if u.Username != "" {
+			if result.Usernames == nil {
+				result.Usernames = map[string]string{}
+			}
+			result.Usernames[u.Id] = u.Username
+		}
+		if u.PublicMetrics != nil {
+			if result.UserMetrics == nil {
+				result.UserMetrics = map[string]UserPublicMetrics{}
+			}
+			result.UserMetrics[u.Id] = *u.PublicMetrics
+		}
+	}
+}
+
+// addTweetMetrics adds the public metrics of an interacted tweet to its author
+func addTweetMetrics(tweet *Tweet, result *UserInteractions) {
+	if tweet.PublicMetrics == nil {
+		return
+	}
+	if result.TweetMetrics == nil {
+		result.TweetMetrics = map[string]TweetPublicMetrics{}
+	}
+	m := result.TweetMetrics[tweet.AuthorUserId]
+	m.add(tweet.PublicMetrics)
+	result.TweetMetrics[tweet.AuthorUserId] = m
+}
+
 // ProcessUserLikes collects author user ids of user's liked tweets
 func (a *Analyzer) ProcessUserLikes(likedTweets *TweetsResponse, result *UserInteractions) {
-	for _, tweet := range likedTweets.Data {
-		if tweet.AuthorUserId != "" {
+	collectIncludedUsers(likedTweets, result)
+
+	for i := range likedTweets.Data {
+		if tweet := &likedTweets.Data[i]; tweet.AuthorUserId != "" {
 			if _, ok := result.UserLikedTweets[tweet.AuthorUserId]; !ok {
 				result.UserLikedTweets[tweet.AuthorUserId] = 0
 			}
 			result.UserLikedTweets[tweet.AuthorUserId]++
+			addTweetMetrics(tweet, result)
 		}
 	}
 }
@@ -189,6 +320,12 @@ func (a *Analyzer) ProcessUserLikes(likedTweets *TweetsResponse, result *UserInt
 // the responses via processAndContinue. This function also handles pagination
 // and rate limiting automatically.
 func (a *Analyzer) CollectAndProcessEndpoint(endpointName string, rateLimiter ApiRateLimiter, fetchFunc func(opts []ApiRequestOption) (*TweetsResponse, error), processAndContinue func(*TweetsResponse) bool) {
+	a.collectAndProcessEndpoint(endpointName, rateLimiter, fetchFunc, processAndContinue)
+}
+
+// collectAndProcessEndpoint is CollectAndProcessEndpoint which returns the
+// fetch error (other than rate limiting) that stopped the collection
+func (a *Analyzer) collectAndProcessEndpoint(endpointName string, rateLimiter ApiRateLimiter, fetchFunc func(opts []ApiRequestOption) (*TweetsResponse, error), processAndContinue func(*TweetsResponse) bool) error {
 	apiRequestOpts := []ApiRequestOption{}
 	for {
 		if rateLimiter.Allow() {
@@ -212,12 +349,16 @@ func (a *Analyzer) CollectAndProcessEndpoint(endpointName string, rateLimiter Ap
 				}
 
 				// Exit on other errors
-				break
+				a.Logger.Error("fetching endpoint failed, stopping",
+					slog.String("endpoint", endpointName),
+					slog.String("error", err.Error()),
+				)
+				return fmt.Errorf("fetching %s: %w", endpointName, err)
 			}
 
 			// Process the result and exit when done
 			if !processAndContinue(tweets) {
-				break
+				return nil
 			}
 
 			// If next token is still available - set it in options
@@ -237,7 +378,9 @@ func (a *Analyzer) CollectAndProcessEndpoint(endpointName string, rateLimiter Ap
 
 // CreateUserInteractionGraph runs a full interaction check for a given user id.
 // Note that due to rate limitin completing the interaction run might take a
-// long time. Make sure you use sensible values for limits.
+// long time. Make sure you use sensible values for limits. When the timeline or
+// the liked tweets could not be fetched completely the interactions collected
+// so far are returned together with the fetch errors.
 func (a *Analyzer) CreateUserInteractionGraph(userTwitterId string) (*UserInteractions, error) {
 	result := NewUserInteractionsObject()
 	result.UserTwitterId = userTwitterId
@@ -247,11 +390,12 @@ func (a *Analyzer) CreateUserInteractionGraph(userTwitterId string) (*UserIntera
 	collectedLikedTweetsNum := 0
 
 	wg := sync.WaitGroup{}
+	var timelineErr, likesErr error
 
 	// Process the tweets timeline
 	wg.Add(1)
 	go func() {
-		a.CollectAndProcessEndpoint("user-timeline-tweets", a.TimelineLimiter,
+		timelineErr = a.collectAndProcessEndpoint("user-timeline-tweets", a.TimelineLimiter,
 			func(opts []ApiRequestOption) (*TweetsResponse, error) {
 				return a.Client.FetchUserTweets(userTwitterId,
 					append(opts, OptApplyMaxResults(strconv.Itoa(int(a.MaxTweetsPerRequest))))...,
@@ -281,7 +425,7 @@ func (a *Analyzer) CreateUserInteractionGraph(userTwitterId string) (*UserIntera
 	// Process user liked tweets
 	wg.Add(1)
 	go func() {
-		a.CollectAndProcessEndpoint("user-liked-tweets", a.LikedTweetsLimiter,
+		likesErr = a.collectAndProcessEndpoint("user-liked-tweets", a.LikedTweetsLimiter,
 			func(opts []ApiRequestOption) (*TweetsResponse, error) {
 				return a.Client.FetchUserLikedTweets(userTwitterId,
 					append(opts, OptApplyMaxResults(strconv.Itoa(int(a.MaxTweetsPerRequest))))...,
@@ -309,10 +453,25 @@ func (a *Analyzer) CreateUserInteractionGraph(userTwitterId string) (*UserIntera
 
 	wg.Wait()
 
-	// Remove all current user entries from the result
-	delete(result.RepliesToOtherUsers, userTwitterId)
-	delete(result.RetweetsToOtherUsers, userTwitterId)
-	delete(result.UserLikedTweets, userTwitterId)
+	removeSelfInteractions(result)
+
+	return result, errors.Join(timelineErr, likesErr)
+}
 
-	return result, nil
+// removeSelfInteractions removes all entries of the analyzed user itself
+// (self replies, retweets and likes) from result, together with the metrics
+// of included users who are not counterparts (for example authors of tweets
+// replied to by others)
+func removeSelfInteractions(result *UserInteractions) {
+	delete(result.RepliesToOtherUsers, result.UserTwitterId)
+	delete(result.RetweetsToOtherUsers, result.UserTwitterId)
+	delete(result.UserLikedTweets, result.UserTwitterId)
+	delete(result.UserMetrics, result.UserTwitterId)
+	delete(result.TweetMetrics, result.UserTwitterId)
+	delete(result.Usernames, result.UserTwitterId)
+	for id := range result.UserMetrics {
+		if result.RepliesToOtherUsers[id] == 0 && result.RetweetsToOtherUsers[id] == 0 && result.UserLikedTweets[id] == 0 {
+			delete(result.UserMetrics, id)
+		}
+	}
 }
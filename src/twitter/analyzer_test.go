@@ -1,10 +1,12 @@
 package twitter
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/D8-X/twitter-counter/src/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProcessDirectUserInteractions(t *testing.T) {
@@ -29,7 +31,16 @@ func TestProcessDirectUserInteractions(t *testing.T) {
 					"other-user-1": 1,
 					"other-user-2": 3,
 				},
-				UserLikedTweets: map[string]uint{},
+				UserLikedTweets:   map[string]uint{},
+				SkippedReferences: map[string]uint{},
+				UserMetrics: map[string]UserPublicMetrics{
+					"other-user-1": {FollowersCount: 1000, FollowingCount: 10},
+				},
+				TweetMetrics: map[string]TweetPublicMetrics{},
+				Usernames: map[string]string{
+					"other-user-1": "other1",
+					"other-user-2": "other2",
+				},
 			},
 			inputResponse: &TweetsResponse{
 				Data: []Tweet{
@@ -108,6 +119,73 @@ func TestProcessDirectUserInteractions(t *testing.T) {
 							TweetId:      "rt-original-4",
 						},
 					},
+					Users: []UserDetail{
+						{
+							Id:            "other-user-1",
+							Username:      "other1",
+							PublicMetrics: &UserPublicMetrics{FollowersCount: 1000, FollowingCount: 10},
+						},
+						// Users without metrics are not collected
+						{Id: "other-user-2", Username: "other2"},
+					},
+				},
+			},
+			inputResult: func() *UserInteractions {
+				o := NewUserInteractionsObject()
+				o.UserTwitterId = "123"
+				return o
+			}(),
+		},
+		{
+			name:   "skipped references by reason",
+			userId: "123",
+			expectResult: &UserInteractions{
+				UserTwitterId:       "123",
+				RepliesToOtherUsers: map[string]uint{},
+				RetweetsToOtherUsers: map[string]uint{
+					"other-user-1": 1,
+				},
+				UserLikedTweets: map[string]uint{},
+				SkippedReferences: map[string]uint{
+					"resource-not-found":          1,
+					"not-authorized-for-resource": 1,
+					SkipReasonMissingFromIncludes: 1,
+				},
+				UserMetrics:  map[string]UserPublicMetrics{},
+				TweetMetrics: map[string]TweetPublicMetrics{},
+				Usernames:    map[string]string{},
+			},
+			inputResponse: &TweetsResponse{
+				Data: []Tweet{
+					{
+						ReferencedTweets: []ReferencedTweetMeta{
+							{Type: Retweet, Id: "rt-original-1"},
+							{Type: Retweet, Id: "rt-deleted"},
+							{Type: Quoted, Id: "rt-protected"},
+							{Type: Quoted, Id: "rt-unknown"},
+						},
+						AuthorUserId: "123",
+					},
+				},
+				Includes: TweetIncludes{
+					Tweets: []Tweet{
+						{
+							AuthorUserId: "other-user-1",
+							TweetId:      "rt-original-1",
+						},
+					},
+				},
+				Errors: []ProblemDetail{
+					{
+						ResourceId:   "rt-deleted",
+						ResourceType: "tweet",
+						Type:         ProblemResourceNotFound,
+					},
+					{
+						ResourceId:   "rt-protected",
+						ResourceType: "tweet",
+						Type:         ProblemNotAuthorizedForResource,
+					},
 				},
 			},
 			inputResult: func() *UserInteractions {
@@ -147,12 +225,19 @@ func TestProcessUserLikes(t *testing.T) {
 					"other-user-1": 1,
 					"other-user-2": 5,
 				},
+				SkippedReferences: map[string]uint{},
+				UserMetrics:       map[string]UserPublicMetrics{},
+				// Summed over the liked tweets with metrics
+				TweetMetrics: map[string]TweetPublicMetrics{
+					"other-user-2": {LikeCount: 12, ImpressionCount: 300},
+				},
+				Usernames: map[string]string{},
 			},
 			inputResponse: &TweetsResponse{
 				Data: []Tweet{
 					{AuthorUserId: "other-user-1"},
-					{AuthorUserId: "other-user-2"},
-					{AuthorUserId: "other-user-2"},
+					{AuthorUserId: "other-user-2", PublicMetrics: &TweetPublicMetrics{LikeCount: 10, ImpressionCount: 100}},
+					{AuthorUserId: "other-user-2", PublicMetrics: &TweetPublicMetrics{LikeCount: 2, ImpressionCount: 200}},
 					{AuthorUserId: "other-user-2"},
 					{AuthorUserId: "other-user-2"},
 					{AuthorUserId: "other-user-2"},
@@ -178,6 +263,27 @@ func TestProcessUserLikes(t *testing.T) {
 	}
 }
 
+func TestRemoveSelfInteractions(t *testing.T) {
+	result := NewUserInteractionsObject()
+	result.UserTwitterId = "123"
+	result.RepliesToOtherUsers = map[string]uint{"123": 2, "other-user-1": 1}
+	result.UserLikedTweets = map[string]uint{"other-user-2": 1}
+	result.UserMetrics = map[string]UserPublicMetrics{
+		"123":          {FollowersCount: 1},
+		"other-user-1": {FollowersCount: 2},
+		"other-user-2": {FollowersCount: 3},
+		// Included as author of a tweet replied to by other-user-1
+		"not-interacted": {FollowersCount: 4},
+	}
+
+	removeSelfInteractions(result)
+	assert.Equal(t, map[string]uint{"other-user-1": 1}, result.RepliesToOtherUsers)
+	assert.Equal(t, map[string]UserPublicMetrics{
+		"other-user-1": {FollowersCount: 2},
+		"other-user-2": {FollowersCount: 3},
+	}, result.UserMetrics)
+}
+
 func TestCollectAndProcessEndpoint(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -186,6 +292,7 @@ func TestCollectAndProcessEndpoint(t *testing.T) {
 		inputFetchFunc     func(*testing.T) func(opts []ApiRequestOption) (*TweetsResponse, error)
 		// Must return false eventually to stop the loop
 		inputProcessAndContinueAssert func(*testing.T) func(*TweetsResponse) bool
+		expectErr                     bool
 	}{
 		{
 			name:              "ok no limiter",
@@ -282,6 +389,25 @@ func TestCollectAndProcessEndpoint(t *testing.T) {
 				marl.EXPECT().Allow().Return(true)
 			},
 		},
+		{
+			name:              "fetch error is returned",
+			inputEndpointName: "test-endpoint",
+			inputFetchFunc: func(T *testing.T) func(opts []ApiRequestOption) (*TweetsResponse, error) {
+				return func(opts []ApiRequestOption) (*TweetsResponse, error) {
+					return nil, &ErrAPI{StatusCode: 500}
+				}
+			},
+			inputProcessAndContinueAssert: func(t *testing.T) func(*TweetsResponse) bool {
+				return func(tr *TweetsResponse) bool {
+					t.Fatal("failed page must not be processed")
+					return false
+				}
+			},
+			expectLimiterCalls: func(marl *mocks.MockApiRateLimiter) {
+				marl.EXPECT().Allow().Return(true).Times(1)
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -293,16 +419,38 @@ func TestCollectAndProcessEndpoint(t *testing.T) {
 			}
 
 			a := NewDevAnalyzer(nil)
-			a.CollectAndProcessEndpoint(
+			err := a.collectAndProcessEndpoint(
 				tt.inputEndpointName,
 				limiter,
 				tt.inputFetchFunc(t),
 				tt.inputProcessAndContinueAssert(t),
 			)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 		})
 	}
 }
 
+// likesFailingClient serves timelines of usersClient and fails all likes
+type likesFailingClient struct {
+	*usersClient
+}
+
+func (c likesFailingClient) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	return nil, &ErrAPI{StatusCode: 503}
+}
+
+func TestCreateUserInteractionGraphPartialResult(t *testing.T) {
+	c := likesFailingClient{&usersClient{replies: map[string][]string{"1": {"2", "2"}}}}
+	result, err := newTestCrawler(c, 1, 1).Analyzer.CreateUserInteractionGraph("1")
+	assert.ErrorContains(t, err, "fetching user-liked-tweets: response failed: 503")
+	require.NotNil(t, result)
+	assert.Equal(t, map[string]uint{"2": 2}, result.RepliesToOtherUsers)
+}
+
 func TestUserInteractionRanked(t *testing.T) {
 
 	u := &UserInteractions{
@@ -342,3 +490,95 @@ func TestUserInteractionRanked(t *testing.T) {
 	assert.Equal(t, wantInteractions, interactions)
 
 }
+
+func TestUserInteractionRankedUsers(t *testing.T) {
+	u := UserInteractions{
+		RepliesToOtherUsers: map[string]uint{
+			"other-user-1": 1,
+			"other-user-2": 5,
+		},
+		RetweetsToOtherUsers: map[string]uint{},
+		UserLikedTweets: map[string]uint{
+			"other-user-1": 1,
+		},
+		UserMetrics: map[string]UserPublicMetrics{
+			"other-user-2": {FollowersCount: 120000, TweetCount: 3000},
+		},
+		TweetMetrics: map[string]TweetPublicMetrics{
+			"other-user-1": {LikeCount: 40, RetweetCount: 3},
+		},
+		Usernames: map[string]string{
+			"other-user-2": "influencer",
+		},
+	}
+
+	assert.Equal(t, []RankedUser{
+		{UserId: "other-user-2", Username: "influencer", Interactions: 5, Metrics: &UserPublicMetrics{FollowersCount: 120000, TweetCount: 3000}},
+		{UserId: "other-user-1", Interactions: 2, TweetMetrics: &TweetPublicMetrics{LikeCount: 40, RetweetCount: 3}},
+	}, u.RankedUsers())
+}
+
+// benchmarkTweetsPage creates a full 100 tweets timeline page where every tweet
+// references another tweet with its author included
+func benchmarkTweetsPage() *TweetsResponse {
+	r := &TweetsResponse{}
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		userId := "user-" + strconv.Itoa(i%20)
+		refType := Retweet
+		if i%2 == 0 {
+			refType = Quoted
+		}
+		r.Data = append(r.Data, Tweet{
+			TweetId:          "tweet-" + id,
+			AuthorUserId:     "seed",
+			ReferencedTweets: []ReferencedTweetMeta{{Type: refType, Id: "ref-" + id}},
+		})
+		r.Includes.Tweets = append(r.Includes.Tweets, Tweet{
+			TweetId:      "ref-" + id,
+			AuthorUserId: userId,
+			TweetText:    "referenced tweet text which is copied when returned by value",
+		})
+		r.Includes.Users = append(r.Includes.Users, UserDetail{
+			Id:            userId,
+			Username:      userId,
+			PublicMetrics: &UserPublicMetrics{FollowersCount: uint(i)},
+		})
+	}
+	return r
+}
+
+// freshPage copies page without its lazily built indexes
+func freshPage(page *TweetsResponse) *TweetsResponse {
+	return &TweetsResponse{
+		Data: page.Data,
+		Includes: TweetIncludes{
+			Tweets: page.Includes.Tweets,
+			Users:  page.Includes.Users,
+		},
+	}
+}
+
+func BenchmarkFindReferencedTweet(b *testing.B) {
+	page := benchmarkTweetsPage()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := freshPage(page)
+		for _, tweet := range r.Data {
+			if r.FindReferencedTweet(tweet.ReferencedTweets[0].Id) == nil {
+				b.Fatal("referenced tweet not found")
+			}
+		}
+	}
+}
+
+func BenchmarkProcessDirectUserInteractions(b *testing.B) {
+	page := benchmarkTweetsPage()
+	a := NewDevAnalyzer(nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		a.ProcessDirectUserInteractions(freshPage(page), NewUserInteractionsObject())
+	}
+}
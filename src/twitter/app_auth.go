@@ -0,0 +1,151 @@
+package twitter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// NewAppOnlyClient creates a client authenticating with app-only bearer token
+// which is minted from the consumer apiKey and apiSecret. The token is
+// requested on the first API call and cached for the lifetime of the client.
+// When API rejects the cached token with HTTP 401, a new token is minted.
+//
+// See
+// https://developer.twitter.com/en/docs/authentication/api-reference/token
+func NewAppOnlyClient(apiKey, apiSecret string, options ...ClientOption) *twitterHTTPClient {
+	auth := &appOnlyAuth{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+	}
+	t := newTwitterHTTPClient(auth, options...)
+
+	// App-only token endpoints live outside of the /2/ api path
+	auth.tokenURL = resolveURL(t.baseURL, "../oauth2/token")
+	auth.invalidateURL = resolveURL(t.baseURL, "../oauth2/invalidate_token")
+	auth.r = t.r
+
+	return t
+}
+
+// InvalidateToken revokes the cached app-only bearer token. A new token will
+// be minted on the next API call. Only clients created with NewAppOnlyClient
+// support token invalidation.
+func (t *twitterHTTPClient) InvalidateToken() error {
+	auth, ok := t.auth.(*appOnlyAuth)
+	if !ok {
+		return fmt.Errorf("token invalidation is only supported for app-only clients")
+	}
+	return auth.invalidate()
+}
+
+// resolveURL resolves ref relative to base url. Returns ref unchanged if
+// base is not a valid url.
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// appOnlyAuth authenticates requests with bearer token minted from consumer
+// key and secret
+type appOnlyAuth struct {
+	apiKey    string
+	apiSecret string
+
+	tokenURL      string
+	invalidateURL string
+	r             *resty.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+func (a *appOnlyAuth) authenticate(req *resty.Request, method, endpoint string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == "" {
+		if err := a.mintLocked(); err != nil {
+			return err
+		}
+	}
+
+	req.SetAuthToken(a.token)
+	return nil
+}
+
+func (a *appOnlyAuth) refreshToken() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.mintLocked()
+}
+
+// consumerRequest creates a request authenticated with consumer credentials.
+// Key and secret are url encoded before base64 encoding as required by the
+// token endpoint.
+func (a *appOnlyAuth) consumerRequest() *resty.Request {
+	return a.r.R().SetBasicAuth(url.QueryEscape(a.apiKey), url.QueryEscape(a.apiSecret))
+}
+
+// appOnlyTokenResponse is the response of oauth2/token and
+// oauth2/invalidate_token endpoints
+type appOnlyTokenResponse struct {
+	TokenType   string `json:"token_type"`
+	AccessToken string `json:"access_token"`
+}
+
+func (a *appOnlyAuth) mintLocked() error {
+	resp, err := a.consumerRequest().
+		SetFormData(map[string]string{"grant_type": "client_credentials"}).
+		Post(a.tokenURL)
+	if err != nil {
+		return fmt.Errorf("minting bearer token: %w", err)
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("minting bearer token: %w", newErrAPI(resp.StatusCode(), resp.Body()))
+	}
+
+	tr := &appOnlyTokenResponse{}
+	if err := json.Unmarshal(resp.Body(), tr); err != nil {
+		return fmt.Errorf("parsing bearer token response: %w", err)
+	}
+	if tr.TokenType != "bearer" || tr.AccessToken == "" {
+		return fmt.Errorf("unexpected bearer token response, token_type: %q", tr.TokenType)
+	}
+
+	a.token = tr.AccessToken
+	return nil
+}
+
+func (a *appOnlyAuth) invalidate() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == "" {
+		return nil
+	}
+
+	resp, err := a.consumerRequest().
+		SetFormData(map[string]string{"access_token": a.token}).
+		Post(a.invalidateURL)
+	if err != nil {
+		return fmt.Errorf("invalidating bearer token: %w", err)
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("invalidating bearer token: %w", newErrAPI(resp.StatusCode(), resp.Body()))
+	}
+
+	a.token = ""
+	return nil
+}
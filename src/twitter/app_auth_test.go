@@ -0,0 +1,77 @@
+package twitter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppOnlyClient(t *testing.T) {
+	minted := atomic.Int32{}
+	invalidated := atomic.Int32{}
+	// Currently valid bearer token
+	valid := atomic.Value{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok)
+			// Key and secret are url encoded before basic auth
+			assert.Equal(t, "api-key", user)
+			assert.Equal(t, "api%2Bsecret", pass)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+
+			token := "token-" + string(rune('0'+minted.Add(1)))
+			valid.Store(token)
+			w.Write([]byte(`{"token_type":"bearer","access_token":"` + token + `"}`))
+		case "/oauth2/invalidate_token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, valid.Load(), r.PostForm.Get("access_token"))
+
+			invalidated.Add(1)
+			valid.Store("")
+			w.Write([]byte(`{"access_token":"` + r.PostForm.Get("access_token") + `"}`))
+		case "/2/users/by":
+			if r.Header.Get("Authorization") != "Bearer "+valid.Load().(string) {
+				w.WriteHeader(401)
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"1","name":"Name","username":"user"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	// Token endpoints are resolved relative to the base url
+	assert.Equal(t, "https://api.twitter.com/oauth2/token", NewAppOnlyClient("k", "s").auth.(*appOnlyAuth).tokenURL)
+
+	c := NewAppOnlyClient("api-key", "api+secret", WithBaseURL(srv.URL+"/2"), WithRetryPolicy(NoRetryPolicy()))
+
+	// Token is minted once and cached
+	for i := 0; i < 3; i++ {
+		_, err := c.FindUserDetails([]string{"user"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), minted.Load())
+
+	// Token revoked elsewhere is minted again on 401
+	valid.Store("token-revoked")
+	_, err := c.FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), minted.Load())
+
+	// Invalidated token is replaced on next call
+	require.NoError(t, c.InvalidateToken())
+	assert.Equal(t, int32(1), invalidated.Load())
+	_, err = c.FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), minted.Load())
+
+	// Other clients do not support invalidation
+	assert.Error(t, NewAuthBearerClient("bearer").InvalidateToken())
+}
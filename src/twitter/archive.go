@@ -0,0 +1,339 @@
+package twitter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ArchivedPage is a single fetched response page kept in the archive.
+type ArchivedPage struct {
+	Endpoint Endpoint `json:"endpoint"`
+	// Path resource id (user or tweet id), or the comma separated usernames
+	// of user lookups
+	Id        string          `json:"id"`
+	Params    url.Values      `json:"params"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Raw       json.RawMessage `json:"raw"`
+}
+
+// tweets parses the raw body of timeline and liked tweets pages
+func (p *ArchivedPage) tweets() (*TweetsResponse, error) {
+	ret := &TweetsResponse{Raw: p.Raw}
+	if err := json.Unmarshal(p.Raw, ret); err != nil {
+		return nil, fmt.Errorf("parsing archived %s page: %w", p.Endpoint, err)
+	}
+	return ret, nil
+}
+
+// ArchiveWriter writes archived pages as gzip compressed json lines. Every
+// page is a complete gzip member written with a single Write call, so an
+// interrupted run keeps what was fetched and later runs can be appended to
+// it. ArchiveWriter is safe for concurrent use.
+type ArchiveWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	buf    bytes.Buffer
+	gz     *gzip.Writer
+	closer io.Closer
+}
+
+// NewArchiveWriter writes the archive to w.
+func NewArchiveWriter(w io.Writer) *ArchiveWriter {
+	a := &ArchiveWriter{w: w}
+	a.gz = gzip.NewWriter(&a.buf)
+	return a
+}
+
+// CreateArchive opens the archive file at path for appending. Archives of
+// several runs are concatenated gzip streams which are read as one archive.
+func CreateArchive(path string) (*ArchiveWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	a := NewArchiveWriter(f)
+	a.closer = f
+	return a, nil
+}
+
+// Write appends page to the archive.
+func (a *ArchiveWriter) Write(page *ArchivedPage) error {
+	line, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("encoding archived page: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.buf.Reset()
+	a.gz.Reset(&a.buf)
+	if _, err := a.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := a.gz.Close(); err != nil {
+		return err
+	}
+	_, err = a.w.Write(a.buf.Bytes())
+	return err
+}
+
+// Close closes the underlying file if the archive was opened by
+// CreateArchive.
+func (a *ArchiveWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// ReadArchive calls fn for every page of the archive in r in the order the
+// pages were written. A page truncated at the end of the archive (a run
+// killed while writing it) is skipped.
+func ReadArchive(r io.Reader, fn func(*ArchivedPage) error) error {
+	gz, err := gzip.NewReader(r)
+	if err == io.EOF {
+		// Nothing was archived yet
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	defer gz.Close()
+
+	tail := &truncatedReader{r: gz}
+	scanner := bufio.NewScanner(tail)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		// Complete pages end with a newline
+		if atEOF && tail.truncated && bytes.IndexByte(data, '\n') < 0 {
+			return len(data), nil, nil
+		}
+		return bufio.ScanLines(data, atEOF)
+	})
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		page := &ArchivedPage{}
+		if err := json.Unmarshal(scanner.Bytes(), page); err != nil {
+			return fmt.Errorf("parsing archived page on line %d: %w", line, err)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	if tail.truncated {
+		slog.Warn("archive ends with a truncated page, skipping it")
+	}
+	return scanner.Err()
+}
+
+// truncatedReader ends the archive at a truncated gzip member instead of
+// failing
+type truncatedReader struct {
+	r         io.Reader
+	truncated bool
+}
+
+func (t *truncatedReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		t.truncated = true
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ReadArchiveFile reads the archive file at path, see ReadArchive.
+func ReadArchiveFile(path string, fn func(*ArchivedPage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+
+	return ReadArchive(f, fn)
+}
+
+// ArchivingClient is a Client decorator which writes the raw body of every
+// successfully fetched page to Archive, so that interactions can be rebuilt
+// later with a different processing policy (see ReplayAnalyzer). Archive
+// failures are logged and do not fail the request.
+type ArchivingClient struct {
+	Client  Client
+	Archive *ArchiveWriter
+
+	now func() time.Time
+}
+
+var _ Client = (*ArchivingClient)(nil)
+
+func NewArchivingClient(c Client, archive *ArchiveWriter) *ArchivingClient {
+	return &ArchivingClient{
+		Client:  c,
+		Archive: archive,
+		now:     time.Now,
+	}
+}
+
+// requestParams returns the query parameters set by options
+func requestParams(options []ApiRequestOption) url.Values {
+	req := resty.New().R()
+	for _, opt := range options {
+		opt.Apply(req)
+	}
+	return req.QueryParam
+}
+
+func (c *ArchivingClient) archive(endpoint Endpoint, id string, options []ApiRequestOption, resp rawResponse) {
+	body := resp.rawBody()
+	if len(body) == 0 {
+		var err error
+		if body, err = json.Marshal(resp); err != nil {
+			return
+		}
+	}
+
+	err := c.Archive.Write(&ArchivedPage{
+		Endpoint:  endpoint,
+		Id:        id,
+		Params:    requestParams(options),
+		FetchedAt: c.now().UTC(),
+		Raw:       body,
+	})
+	if err != nil {
+		slog.Error("archiving page failed",
+			slog.String("endpoint", string(endpoint)),
+			slog.String("id", id),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (c *ArchivingClient) FetchUserTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	resp, err := c.Client.FetchUserTweets(userId, options...)
+	if err == nil {
+		c.archive(EndpointUserTweets, userId, options, resp)
+	}
+	return resp, err
+}
+
+func (c *ArchivingClient) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	resp, err := c.Client.FetchUserLikedTweets(userId, options...)
+	if err == nil {
+		c.archive(EndpointUserLikedTweets, userId, options, resp)
+	}
+	return resp, err
+}
+
+func (c *ArchivingClient) FetchTweetLikers(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
+	resp, err := c.Client.FetchTweetLikers(tweetId, options...)
+	if err == nil {
+		c.archive(EndpointTweetLikers, tweetId, options, resp)
+	}
+	return resp, err
+}
+
+func (c *ArchivingClient) FetchTweetRetweeters(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
+	resp, err := c.Client.FetchTweetRetweeters(tweetId, options...)
+	if err == nil {
+		c.archive(EndpointTweetRetweeters, tweetId, options, resp)
+	}
+	return resp, err
+}
+
+func (c *ArchivingClient) FindUserDetails(userNames []string, options ...ApiRequestOption) (*UserLookupResponse, error) {
+	resp, err := c.Client.FindUserDetails(userNames, options...)
+	if err == nil {
+		c.archive(EndpointUserLookup, strings.Join(userNames, ","), options, resp)
+	}
+	return resp, err
+}
+
+// ReplayAnalyzer rebuilds UserInteractions offline from an archive written by
+// ArchivingClient. Timeline and liked tweets pages of the user are processed
+// by Analyzer the same way as during a live run, so a changed processing
+// policy can be applied to already fetched data without hitting the API.
+type ReplayAnalyzer struct {
+	Analyzer *Analyzer
+
+	// Only pages fetched within [Since, Until) are replayed, zero values are
+	// unbounded
+	Since time.Time
+	Until time.Time
+}
+
+func NewReplayAnalyzer() *ReplayAnalyzer {
+	return &ReplayAnalyzer{
+		Analyzer: &Analyzer{Logger: slog.Default()},
+	}
+}
+
+// CreateUserInteractionGraph rebuilds the interactions of userTwitterId from
+// the archive in r. Tweets archived by several runs are counted once.
+func (r *ReplayAnalyzer) CreateUserInteractionGraph(archive io.Reader, userTwitterId string) (*UserInteractions, error) {
+	result := NewUserInteractionsObject()
+	result.UserTwitterId = userTwitterId
+
+	seen := map[Endpoint]map[string]bool{
+		EndpointUserTweets:      {},
+		EndpointUserLikedTweets: {},
+	}
+	pages := 0
+	err := ReadArchive(archive, func(page *ArchivedPage) error {
+		seenTweets, ok := seen[page.Endpoint]
+		if !ok || page.Id != userTwitterId {
+			return nil
+		}
+		if (!r.Since.IsZero() && page.FetchedAt.Before(r.Since)) || (!r.Until.IsZero() && !page.FetchedAt.Before(r.Until)) {
+			return nil
+		}
+
+		tweets, err := page.tweets()
+		if err != nil {
+			return err
+		}
+		unseen := tweets.Data[:0]
+		for _, t := range tweets.Data {
+			if !seenTweets[t.TweetId] {
+				seenTweets[t.TweetId] = true
+				unseen = append(unseen, t)
+			}
+		}
+		tweets.Data = unseen
+
+		if page.Endpoint == EndpointUserTweets {
+			r.Analyzer.ProcessDirectUserInteractions(tweets, result)
+		} else {
+			r.Analyzer.ProcessUserLikes(tweets, result)
+		}
+		pages++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removeSelfInteractions(result)
+	r.Analyzer.Logger.Info("replayed archived pages",
+		slog.String("user_id", userTwitterId),
+		slog.Int("pages", pages),
+	)
+	return result, nil
+}
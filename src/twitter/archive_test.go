@@ -0,0 +1,202 @@
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagesClient serves the same raw timeline and liked tweets pages for every
+// call
+type pagesClient struct {
+	Client
+	timeline string
+	liked    string
+}
+
+func parseTweets(t *testing.T, raw string) *TweetsResponse {
+	resp := &TweetsResponse{Raw: json.RawMessage(raw)}
+	require.NoError(t, json.Unmarshal(resp.Raw, resp))
+	return resp
+}
+
+func (c *pagesClient) FetchUserTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	resp := &TweetsResponse{Raw: json.RawMessage(c.timeline)}
+	return resp, json.Unmarshal(resp.Raw, resp)
+}
+
+func (c *pagesClient) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	resp := &TweetsResponse{Raw: json.RawMessage(c.liked)}
+	return resp, json.Unmarshal(resp.Raw, resp)
+}
+
+func TestArchivingClientAndReplay(t *testing.T) {
+	c := &pagesClient{
+		timeline: `{"data":[
+			{"id":"11","author_id":"1","in_reply_to_user_id":"2"},
+			{"id":"12","author_id":"1","referenced_tweets":[{"type":"retweeted","id":"21"}]},
+			{"id":"13","author_id":"1","in_reply_to_user_id":"1"}
+		],"includes":{"tweets":[{"id":"21","author_id":"3"}],"users":[{"id":"3","username":"three"}]}}`,
+		liked: `{"data":[{"id":"31","author_id":"2"},{"id":"32","author_id":"4"}]}`,
+	}
+
+	buf := &bytes.Buffer{}
+	archive := NewArchiveWriter(buf)
+	ac := NewArchivingClient(c, archive)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ac.now = func() time.Time { return now }
+
+	// Two runs fetching the same pages
+	for i := 0; i < 2; i++ {
+		_, err := ac.FetchUserTweets("1", OptApplyMaxResults("100"))
+		require.NoError(t, err)
+		_, err = ac.FetchUserLikedTweets("1")
+		require.NoError(t, err)
+		now = now.Add(time.Hour * 24)
+	}
+	require.NoError(t, archive.Close())
+
+	pages := []*ArchivedPage{}
+	require.NoError(t, ReadArchive(bytes.NewReader(buf.Bytes()), func(p *ArchivedPage) error {
+		pages = append(pages, p)
+		return nil
+	}))
+	require.Len(t, pages, 4)
+	assert.Equal(t, EndpointUserTweets, pages[0].Endpoint)
+	assert.Equal(t, "1", pages[0].Id)
+	assert.Equal(t, url.Values{"max_results": {"100"}}, pages[0].Params)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), pages[0].FetchedAt)
+	assert.JSONEq(t, c.timeline, string(pages[0].Raw))
+	assert.Equal(t, EndpointUserLikedTweets, pages[3].Endpoint)
+
+	t.Run("replay counts each tweet once", func(t *testing.T) {
+		result, err := NewReplayAnalyzer().CreateUserInteractionGraph(bytes.NewReader(buf.Bytes()), "1")
+		require.NoError(t, err)
+
+		live := NewUserInteractionsObject()
+		live.UserTwitterId = "1"
+		a := &Analyzer{}
+		a.ProcessDirectUserInteractions(parseTweets(t, c.timeline), live)
+		a.ProcessUserLikes(parseTweets(t, c.liked), live)
+		removeSelfInteractions(live)
+
+		assert.Equal(t, live, result)
+		assert.Equal(t, map[string]uint{"2": 1}, result.RepliesToOtherUsers)
+		assert.Equal(t, map[string]string{"3": "three"}, result.Usernames)
+	})
+
+	t.Run("replay window", func(t *testing.T) {
+		r := NewReplayAnalyzer()
+		r.Since = time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+		r.Until = time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+		result, err := r.CreateUserInteractionGraph(bytes.NewReader(buf.Bytes()), "1")
+		require.NoError(t, err)
+		// Second run was fetched exactly at Until
+		assert.Empty(t, result.RepliesToOtherUsers)
+		assert.Empty(t, result.UserLikedTweets)
+	})
+
+	t.Run("other users are not replayed", func(t *testing.T) {
+		result, err := NewReplayAnalyzer().CreateUserInteractionGraph(bytes.NewReader(buf.Bytes()), "2")
+		require.NoError(t, err)
+		assert.Empty(t, result.RepliesToOtherUsers)
+	})
+}
+
+// chunkWriter records every Write call
+type chunkWriter struct {
+	chunks [][]byte
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.chunks = append(w.chunks, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func TestArchiveFileInterruptedRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl.gz")
+	page := func(id string) *ArchivedPage {
+		return &ArchivedPage{Endpoint: EndpointUserTweets, Id: id, Raw: json.RawMessage(`{"data":[]}`)}
+	}
+
+	// First run is interrupted before Close
+	first, err := CreateArchive(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { first.Close() })
+	require.NoError(t, first.Write(page("1")))
+	require.NoError(t, first.Write(page("2")))
+
+	second, err := CreateArchive(path)
+	require.NoError(t, err)
+	require.NoError(t, second.Write(page("3")))
+
+	read := func() []string {
+		ids := []string{}
+		require.NoError(t, ReadArchiveFile(path, func(p *ArchivedPage) error {
+			ids = append(ids, p.Id)
+			return nil
+		}))
+		return ids
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, read())
+
+	require.NoError(t, second.Close())
+	assert.Equal(t, []string{"1", "2", "3"}, read())
+
+	t.Run("truncated tail", func(t *testing.T) {
+		// Run killed in the middle of writing page 4
+		buf := &bytes.Buffer{}
+		require.NoError(t, NewArchiveWriter(buf).Write(page("4")))
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		read := func(cut int) []string {
+			truncated := append(append([]byte{}, contents...), buf.Bytes()[:cut]...)
+			ids := []string{}
+			require.NoError(t, ReadArchive(bytes.NewReader(truncated), func(p *ArchivedPage) error {
+				ids = append(ids, p.Id)
+				return nil
+			}), cut)
+			return ids
+		}
+		assert.Equal(t, []string{"1", "2", "3"}, read(buf.Len()/2))
+		// Page 4 is kept when only the end of its gzip member is missing
+		for cut := 1; cut < buf.Len(); cut++ {
+			ids := read(cut)
+			assert.Equal(t, []string{"1", "2", "3"}, ids[:3], cut)
+			assert.LessOrEqual(t, len(ids), 4, cut)
+		}
+	})
+
+	t.Run("page per write", func(t *testing.T) {
+		w := &chunkWriter{}
+		a := NewArchiveWriter(w)
+		require.NoError(t, a.Write(page("1")))
+		require.NoError(t, a.Write(page("2")))
+		require.Len(t, w.chunks, 2)
+		for i, chunk := range w.chunks {
+			require.NoError(t, ReadArchive(bytes.NewReader(chunk), func(p *ArchivedPage) error {
+				assert.Equal(t, strconv.Itoa(i+1), p.Id)
+				return nil
+			}))
+		}
+	})
+
+	t.Run("empty archive", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.jsonl.gz")
+		a, err := CreateArchive(empty)
+		require.NoError(t, err)
+		require.NoError(t, a.Close())
+		assert.NoError(t, ReadArchiveFile(empty, func(p *ArchivedPage) error {
+			t.Fatal("unexpected page")
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,329 @@
+package twitter
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry is a cached raw API response.
+type CacheEntry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// CacheStorage stores cached responses of CachingClient. Expiration is
+// handled by CachingClient, storages only need to keep the entries.
+type CacheStorage interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry) error
+	Delete(key string) error
+}
+
+// MemoryCache is an in-memory least recently used CacheStorage. When capacity
+// is reached, the least recently used entry is evicted.
+type MemoryCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var _ CacheStorage = (*MemoryCache)(nil)
+
+type memoryCacheItem struct {
+	key   string
+	entry CacheEntry
+}
+
+// NewMemoryCache creates LRU cache holding up to capacity entries.
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (m *MemoryCache) Get(key string) (CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	m.order.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).entry, true
+}
+
+func (m *MemoryCache) Set(key string, entry CacheEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		el.Value.(*memoryCacheItem).entry = entry
+		m.order.MoveToFront(el)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for m.capacity > 0 && m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+func (m *MemoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		m.order.Remove(el)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+// DiskCache is a CacheStorage keeping each entry in a separate json file in
+// Dir, so that the cache survives between runs.
+type DiskCache struct {
+	Dir string
+}
+
+var _ CacheStorage = (*DiskCache)(nil)
+
+// NewDiskCache creates disk cache in dir, the directory is created if it does
+// not exist.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{Dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d *DiskCache) Get(key string) (CacheEntry, bool) {
+	contents, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return CacheEntry{}, false
+	}
+
+	entry := CacheEntry{}
+	if err := json.Unmarshal(contents, &entry); err != nil {
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (d *DiskCache) Set(key string, entry CacheEntry) error {
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := d.path(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *DiskCache) Delete(key string) error {
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// CacheStats are hit and miss counters of a single endpoint.
+type CacheStats struct {
+	Hits   uint
+	Misses uint
+}
+
+// DefaultCacheTTLs caches user lookups for a day and likers and retweeters for
+// an hour. Timelines are not cached as they change with every new tweet.
+func DefaultCacheTTLs() map[Endpoint]time.Duration {
+	return map[Endpoint]time.Duration{
+		EndpointUserLookup:      time.Hour * 24,
+		EndpointTweetLikers:     time.Hour,
+		EndpointTweetRetweeters: time.Hour,
+	}
+}
+
+// CachingClient is a Client decorator which serves repeated requests from
+// Storage, so they do not consume the API rate limit. Responses are cached by
+// endpoint and query parameters for the endpoint TTL. Endpoints without a TTL
+// are not cached. Only successful responses are cached.
+type CachingClient struct {
+	Client  Client
+	Storage CacheStorage
+	TTLs    map[Endpoint]time.Duration
+
+	now func() time.Time
+
+	mu    sync.Mutex
+	stats map[Endpoint]CacheStats
+}
+
+var _ Client = (*CachingClient)(nil)
+
+// NewCachingClient wraps c with a cache in storage. When ttls is nil,
+// DefaultCacheTTLs are used.
+func NewCachingClient(c Client, storage CacheStorage, ttls map[Endpoint]time.Duration) *CachingClient {
+	if ttls == nil {
+		ttls = DefaultCacheTTLs()
+	}
+	return &CachingClient{
+		Client:  c,
+		Storage: storage,
+		TTLs:    ttls,
+		now:     time.Now,
+		stats:   map[Endpoint]CacheStats{},
+	}
+}
+
+// Stats returns hit and miss counters of cached endpoints.
+func (c *CachingClient) Stats() map[Endpoint]CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := make(map[Endpoint]CacheStats, len(c.stats))
+	for k, v := range c.stats {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (c *CachingClient) count(endpoint Endpoint, hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := c.stats[endpoint]
+	if hit {
+		st.Hits++
+	} else {
+		st.Misses++
+	}
+	c.stats[endpoint] = st
+}
+
+// cacheKey builds the cache key from endpoint, path resource id and the query
+// parameters set by options. Query parameters are sorted by Encode.
+func cacheKey(endpoint Endpoint, id string, options []ApiRequestOption) string {
+	return string(endpoint) + " " + id + "?" + requestParams(options).Encode()
+}
+
+// rawResponse is implemented by responses which keep the raw API body
+type rawResponse interface {
+	rawBody() json.RawMessage
+	setRawBody(json.RawMessage)
+}
+
+func (u *TweetsResponse) rawBody() json.RawMessage              { return u.Raw }
+func (u *TweetsResponse) setRawBody(b json.RawMessage)          { u.Raw = b }
+func (u *UserInteractorsResponse) rawBody() json.RawMessage     { return u.Raw }
+func (u *UserInteractorsResponse) setRawBody(b json.RawMessage) { u.Raw = b }
+func (u *UserLookupResponse) rawBody() json.RawMessage          { return u.Raw }
+func (u *UserLookupResponse) setRawBody(b json.RawMessage)      { u.Raw = b }
+
+// cacheDo returns the cached response for key or runs call and caches its
+// result. Cached raw bodies are parsed again on every hit so that callers
+// never share the returned objects.
+func cacheDo[T any, PT interface {
+	*T
+	rawResponse
+}](c *CachingClient, endpoint Endpoint, key string, call func() (PT, error)) (PT, error) {
+	ttl := c.TTLs[endpoint]
+	if ttl <= 0 {
+		return call()
+	}
+
+	if entry, ok := c.Storage.Get(key); ok {
+		if c.now().Before(entry.ExpiresAt) {
+			ret := PT(new(T))
+			if err := json.Unmarshal(entry.Value, ret); err == nil {
+				ret.setRawBody(entry.Value)
+				c.count(endpoint, true)
+				return ret, nil
+			}
+		}
+		c.Storage.Delete(key)
+	}
+	c.count(endpoint, false)
+
+	ret, err := call()
+	if err != nil {
+		return nil, err
+	}
+
+	body := ret.rawBody()
+	if len(body) == 0 {
+		if body, err = json.Marshal(ret); err != nil {
+			return ret, nil
+		}
+	}
+	if err := c.Storage.Set(key, CacheEntry{Value: body, ExpiresAt: c.now().Add(ttl)}); err != nil {
+		slog.Warn("caching response failed",
+			slog.String("endpoint", string(endpoint)),
+			slog.String("error", err.Error()),
+		)
+	}
+	return ret, nil
+}
+
+func (c *CachingClient) FetchUserTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	return cacheDo(c, EndpointUserTweets, cacheKey(EndpointUserTweets, userId, options), func() (*TweetsResponse, error) {
+		return c.Client.FetchUserTweets(userId, options...)
+	})
+}
+
+func (c *CachingClient) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	return cacheDo(c, EndpointUserLikedTweets, cacheKey(EndpointUserLikedTweets, userId, options), func() (*TweetsResponse, error) {
+		return c.Client.FetchUserLikedTweets(userId, options...)
+	})
+}
+
+func (c *CachingClient) FetchTweetLikers(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
+	return cacheDo(c, EndpointTweetLikers, cacheKey(EndpointTweetLikers, tweetId, options), func() (*UserInteractorsResponse, error) {
+		return c.Client.FetchTweetLikers(tweetId, options...)
+	})
+}
+
+func (c *CachingClient) FetchTweetRetweeters(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
+	return cacheDo(c, EndpointTweetRetweeters, cacheKey(EndpointTweetRetweeters, tweetId, options), func() (*UserInteractorsResponse, error) {
+		return c.Client.FetchTweetRetweeters(tweetId, options...)
+	})
+}
+
+func (c *CachingClient) FindUserDetails(userNames []string, options ...ApiRequestOption) (*UserLookupResponse, error) {
+	key := cacheKey(EndpointUserLookup, strings.Join(userNames, ","), options)
+	return cacheDo(c, EndpointUserLookup, key, func() (*UserLookupResponse, error) {
+		return c.Client.FindUserDetails(userNames, options...)
+	})
+}
@@ -0,0 +1,106 @@
+package twitter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemoryCache(2)
+	require.NoError(t, m.Set("a", CacheEntry{Value: []byte(`1`)}))
+	require.NoError(t, m.Set("b", CacheEntry{Value: []byte(`2`)}))
+
+	// Touch a so that b becomes the least recently used
+	_, ok := m.Get("a")
+	assert.True(t, ok)
+	require.NoError(t, m.Set("c", CacheEntry{Value: []byte(`3`)}))
+
+	_, ok = m.Get("b")
+	assert.False(t, ok)
+	_, ok = m.Get("a")
+	assert.True(t, ok)
+	_, ok = m.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, m.Len())
+}
+
+func TestCachingClient(t *testing.T) {
+	diskCache, err := NewDiskCache(t.TempDir())
+	require.NoError(t, err)
+
+	storages := []struct {
+		name    string
+		storage CacheStorage
+	}{
+		{"memory", NewMemoryCache(100)},
+		{"disk", diskCache},
+	}
+
+	for _, tc := range storages {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &stubClient{}
+			c := NewCachingClient(stub, tc.storage, nil)
+			now := time.Unix(1700000000, 0)
+			c.now = func() time.Time { return now }
+
+			first, err := c.FindUserDetails([]string{"user"})
+			require.NoError(t, err)
+			second, err := c.FindUserDetails([]string{"user"})
+			require.NoError(t, err)
+			assert.Equal(t, first.Data, second.Data)
+			assert.Equal(t, 1, stub.calls)
+
+			// Different query is a miss
+			_, err = c.FindUserDetails([]string{"other"})
+			require.NoError(t, err)
+			assert.Equal(t, 2, stub.calls)
+
+			// Entry expires after the endpoint TTL
+			now = now.Add(time.Hour * 25)
+			_, err = c.FindUserDetails([]string{"user"})
+			require.NoError(t, err)
+			assert.Equal(t, 3, stub.calls)
+
+			assert.Equal(t, map[Endpoint]CacheStats{
+				EndpointUserLookup: {Hits: 1, Misses: 3},
+			}, c.Stats())
+		})
+	}
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		stub := &stubClient{err: errors.New("failed")}
+		c := NewCachingClient(stub, NewMemoryCache(10), nil)
+
+		for i := 0; i < 2; i++ {
+			_, err := c.FindUserDetails([]string{"user"})
+			assert.Error(t, err)
+		}
+		assert.Equal(t, 2, stub.calls)
+	})
+
+	t.Run("endpoints without ttl are not cached", func(t *testing.T) {
+		stub := &stubClient{}
+		c := NewCachingClient(stub, NewMemoryCache(10), map[Endpoint]time.Duration{})
+
+		for i := 0; i < 2; i++ {
+			_, err := c.FindUserDetails([]string{"user"})
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, stub.calls)
+		assert.Empty(t, c.Stats())
+	})
+}
+
+func TestCacheKey(t *testing.T) {
+	// Query parameter order does not matter
+	a := cacheKey(EndpointTweetLikers, "1", []ApiRequestOption{OptApplyMaxResults("10"), OptApplyPaginationToken("x")})
+	b := cacheKey(EndpointTweetLikers, "1", []ApiRequestOption{OptApplyPaginationToken("x"), OptApplyMaxResults("10")})
+	assert.Equal(t, a, b)
+
+	assert.NotEqual(t, a, cacheKey(EndpointTweetRetweeters, "1", []ApiRequestOption{OptApplyMaxResults("10"), OptApplyPaginationToken("x")}))
+	assert.NotEqual(t, a, cacheKey(EndpointTweetLikers, "2", []ApiRequestOption{OptApplyMaxResults("10"), OptApplyPaginationToken("x")}))
+}
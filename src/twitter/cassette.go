@@ -0,0 +1,363 @@
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scrubbedValue replaces credentials in recorded cassettes
+const scrubbedValue = "[scrubbed]"
+
+// scrubbedHeaders are never written to cassettes
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// scrubbedTokenFields are the secret fields of token endpoint responses
+var scrubbedTokenFields = []string{"access_token", "refresh_token"}
+
+// Cassette is a recording of API traffic which can be replayed offline with
+// ReplayTransport.
+type Cassette struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// CassetteInteraction is a single recorded request and its response.
+type CassetteInteraction struct {
+	RecordedAt time.Time        `json:"recorded_at"`
+	Request    CassetteRequest  `json:"request"`
+	Response   CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+}
+
+// LoadCassette reads a cassette file written by RecordingTransport.
+func LoadCassette(path string) (*Cassette, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err := json.Unmarshal(contents, c); err != nil {
+		return nil, fmt.Errorf("parsing cassette: %w", err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to path.
+func (c *Cassette) Save(path string) error {
+	contents, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// scrubHeaders copies h without credential headers
+func scrubHeaders(h http.Header) http.Header {
+	ret := h.Clone()
+	for _, k := range scrubbedHeaders {
+		if ret.Get(k) != "" {
+			ret.Set(k, scrubbedValue)
+		}
+	}
+	return ret
+}
+
+// scrubTokenBody replaces the token values of a token endpoint response body,
+// so that replayed clients can still parse the response. Bodies which are not
+// json objects are replaced completely.
+func scrubTokenBody(body string) string {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return scrubbedValue
+	}
+	for _, k := range scrubbedTokenFields {
+		if _, ok := fields[k]; ok {
+			fields[k] = json.RawMessage(`"` + scrubbedValue + `"`)
+		}
+	}
+	ret, err := json.Marshal(fields)
+	if err != nil {
+		return scrubbedValue
+	}
+	return string(ret)
+}
+
+// isTokenEndpoint returns true for oauth token endpoints which carry secrets
+// in request and response bodies
+func isTokenEndpoint(u *url.URL) bool {
+	return strings.Contains(u.Path, "/oauth2/")
+}
+
+// isStreamEndpoint returns true for long lived streaming endpoints whose
+// responses never complete
+func isStreamEndpoint(u *url.URL) bool {
+	return strings.HasSuffix(u.Path, "/"+string(EndpointSearchStream)) ||
+		strings.HasSuffix(u.Path, "/"+string(EndpointSampleStream))
+}
+
+// cassetteKey identifies requests for replay matching. Query parameters are
+// sorted so that parameter order does not matter.
+func cassetteKey(method string, u *url.URL) string {
+	return method + " " + u.Scheme + "://" + u.Host + u.Path + "?" + u.Query().Encode()
+}
+
+// cassetteTrailer closes the interactions array of cassette files written by
+// RecordingTransport
+const cassetteTrailer = "\n]}\n"
+
+// RecordingTransport is a http.RoundTripper which records every request and
+// response to a cassette file. Credentials are scrubbed before writing. Each
+// interaction is appended to the cassette file as soon as it completes, so
+// that partial runs are kept. Close closes the file. Filtered and sampled
+// stream connections are passed through without recording, their responses
+// never complete.
+type RecordingTransport struct {
+	// Transport sends the requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+
+	path string
+
+	mu       sync.Mutex
+	cassette *Cassette
+	file     *os.File
+	// Size of the written cassette file
+	size int64
+}
+
+var _ http.RoundTripper = (*RecordingTransport)(nil)
+
+// NewRecordingTransport creates a transport recording to cassette file at
+// path. Use with WithTransport client option.
+func NewRecordingTransport(path string) *RecordingTransport {
+	return &RecordingTransport{
+		path:     path,
+		cassette: &Cassette{},
+	}
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *RecordingTransport) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Cassette{Interactions: append([]CassetteInteraction{}, r.cassette.Interactions...)}
+}
+
+func (r *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if isStreamEndpoint(req.URL) {
+		return transport.RoundTrip(req)
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := CassetteInteraction{
+		RecordedAt: time.Now().UTC(),
+		Request: CassetteRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: scrubHeaders(req.Header),
+			Body:    string(reqBody),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    scrubHeaders(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+	if isTokenEndpoint(req.URL) {
+		if interaction.Request.Body != "" {
+			interaction.Request.Body = scrubbedValue
+		}
+		interaction.Response.Body = scrubTokenBody(interaction.Response.Body)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.appendLocked(&interaction); err != nil {
+		return nil, fmt.Errorf("saving cassette: %w", err)
+	}
+
+	return resp, nil
+}
+
+// appendLocked writes interaction over the trailer of the cassette file and
+// closes the file contents with the trailer again. The cassette file is
+// created on the first interaction.
+func (r *RecordingTransport) appendLocked(interaction *CassetteInteraction) error {
+	item, err := json.MarshalIndent(interaction, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	if r.file == nil {
+		// Reopened after Close, keep the recorded interactions
+		flag := os.O_RDWR
+		if r.size == 0 {
+			flag |= os.O_CREATE | os.O_TRUNC
+		}
+		if r.file, err = os.OpenFile(r.path, flag, 0644); err != nil {
+			return err
+		}
+	}
+
+	var buf []byte
+	offset := r.size - int64(len(cassetteTrailer))
+	if r.size == 0 {
+		offset = 0
+		buf = append(buf, `{"interactions":[`+"\n  "...)
+	} else {
+		buf = append(buf, ",\n  "...)
+	}
+	buf = append(append(buf, item...), cassetteTrailer...)
+
+	if _, err := r.file.WriteAt(buf, offset); err != nil {
+		return err
+	}
+	r.size = offset + int64(len(buf))
+	return nil
+}
+
+// Close closes the cassette file.
+func (r *RecordingTransport) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// ReplayTransport is a http.RoundTripper which serves responses from a
+// cassette without network access. Requests are matched by method and url
+// (including query parameters). Repeated identical requests are served in
+// the recorded order, requests which were not recorded fail with an error.
+type ReplayTransport struct {
+	mu      sync.Mutex
+	pending map[string][]CassetteInteraction
+}
+
+var _ http.RoundTripper = (*ReplayTransport)(nil)
+
+// NewReplayTransport creates a transport serving interactions of c.
+func NewReplayTransport(c *Cassette) (*ReplayTransport, error) {
+	r := &ReplayTransport{
+		pending: map[string][]CassetteInteraction{},
+	}
+	for _, i := range c.Interactions {
+		u, err := url.Parse(i.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing recorded url: %w", err)
+		}
+		key := cassetteKey(i.Request.Method, u)
+		r.pending[key] = append(r.pending[key], i)
+	}
+	return r, nil
+}
+
+// NewReplayTransportFromFile loads cassette from path and creates a replay
+// transport for it.
+func NewReplayTransportFromFile(path string) (*ReplayTransport, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayTransport(c)
+}
+
+// Remaining returns the number of recorded interactions which were not
+// replayed yet.
+func (r *ReplayTransport) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, p := range r.pending {
+		n += len(p)
+	}
+	return n
+}
+
+func (r *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := cassetteKey(req.Method, req.URL)
+
+	r.mu.Lock()
+	pending := r.pending[key]
+	if len(pending) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded interaction for %s", key)
+	}
+	interaction := pending[0]
+	r.pending[key] = pending[1:]
+	r.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Response.Headers.Clone(),
+		Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+		ContentLength: int64(len(interaction.Response.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package twitter
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-rate-limit-remaining", "10")
+		switch r.URL.Path {
+		case "/2/users/by":
+			w.Write([]byte(`{"data":[{"id":"1","name":"Name","username":"` + r.URL.Query().Get("usernames") + `"}]}`))
+		case "/2/users/1/liked_tweets":
+			if r.URL.Query().Get("pagination_token") == "" {
+				w.Write([]byte(`{"data":[{"id":"10","author_id":"2","text":"first"}],"meta":{"next_token":"page-2"}}`))
+			} else {
+				w.Write([]byte(`{"data":[{"id":"11","author_id":"3","text":"second"}],"meta":{}}`))
+			}
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := NewRecordingTransport(path)
+	c := NewAuthBearerClient("secret-bearer", WithBaseURL(srv.URL+"/2/"), WithTransport(recorder))
+
+	users, err := c.FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	page1, err := c.FetchUserLikedTweets("1")
+	require.NoError(t, err)
+	page2, err := c.FetchUserLikedTweets("1", OptApplyPaginationToken(page1.Meta.NextToken))
+	require.NoError(t, err)
+
+	srv.Close()
+
+	// Credentials are never written to the cassette
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(string(contents), "secret-bearer"))
+	assert.Len(t, recorder.Cassette().Interactions, 3)
+
+	replay, err := NewReplayTransportFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, replay.Remaining())
+
+	// Server is closed, all responses come from the cassette. Query
+	// parameter order does not matter.
+	offline := NewAuthBearerClient("other-bearer",
+		WithBaseURL(srv.URL+"/2/"),
+		WithTransport(replay),
+		WithRetryPolicy(NoRetryPolicy()),
+	)
+
+	replayedPage2, err := offline.FetchUserLikedTweets("1", OptApplyPaginationToken("page-2"))
+	require.NoError(t, err)
+	assert.Equal(t, page2, replayedPage2)
+
+	replayedUsers, err := offline.FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	assert.Equal(t, users, replayedUsers)
+
+	replayedPage1, err := offline.FetchUserLikedTweets("1")
+	require.NoError(t, err)
+	assert.Equal(t, page1, replayedPage1)
+
+	assert.Equal(t, 0, replay.Remaining())
+
+	// Not recorded requests fail
+	_, err = offline.FindUserDetails([]string{"other"})
+	assert.ErrorContains(t, err, "no recorded interaction")
+}
+
+func TestCassetteAppOnlyAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			w.Write([]byte(`{"token_type":"bearer","access_token":"secret-token"}`))
+		case "/2/users/by":
+			w.Write([]byte(`{"data":[{"id":"1","name":"Name","username":"user"}]}`))
+		}
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := NewRecordingTransport(path)
+	c := NewAppOnlyClient("api-key", "api-secret", WithBaseURL(srv.URL+"/2/"), WithTransport(recorder))
+	users, err := c.FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	require.NoError(t, recorder.Close())
+	srv.Close()
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "secret-token")
+
+	cassette, err := LoadCassette(path)
+	require.NoError(t, err)
+	require.Len(t, cassette.Interactions, 2)
+	assert.JSONEq(t, `{"token_type":"bearer","access_token":"[scrubbed]"}`, cassette.Interactions[0].Response.Body)
+
+	// Replayed token response is parsed and used for the next request
+	replay, err := NewReplayTransport(cassette)
+	require.NoError(t, err)
+	offline := NewAppOnlyClient("api-key", "api-secret",
+		WithBaseURL(srv.URL+"/2/"),
+		WithTransport(replay),
+		WithRetryPolicy(NoRetryPolicy()),
+	)
+	replayed, err := offline.FindUserDetails([]string{"user"})
+	require.NoError(t, err)
+	assert.Equal(t, users, replayed)
+	assert.Equal(t, 0, replay.Remaining())
+}
+
+func TestRecordingTransportAppends(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := NewRecordingTransport(path)
+	c := NewAuthBearerClient("bearer", WithBaseURL(srv.URL+"/2/"), WithTransport(recorder))
+
+	// Cassette is complete after every interaction, also after reopening
+	for i := 1; i <= 3; i++ {
+		_, err := c.FetchUserTweets("1")
+		require.NoError(t, err)
+		cassette, err := LoadCassette(path)
+		require.NoError(t, err)
+		assert.Len(t, cassette.Interactions, i)
+		if i == 2 {
+			require.NoError(t, recorder.Close())
+		}
+	}
+	require.NoError(t, recorder.Close())
+}
+
+func TestRecordingTransportStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"1","text":"hello"}}` + "\r\n"))
+		w.(http.Flusher).Flush()
+		// Stream stays open until the client disconnects
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := NewRecordingTransport(path)
+	c := NewAuthBearerClient("bearer", WithBaseURL(srv.URL+"/2/"), WithTransport(recorder))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	body, err := c.OpenStream(ctx, EndpointSearchStream)
+	require.NoError(t, err)
+	line, err := bufio.NewReader(body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, "hello")
+	body.Close()
+
+	assert.Empty(t, recorder.Cassette().Interactions)
+}
@@ -0,0 +1,327 @@
+package twitter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultPageRankDamping is the probability of following an interaction
+// instead of jumping to a random user.
+const DefaultPageRankDamping = 0.85
+
+const (
+	centralityTolerance     = 1e-10
+	centralityMaxIterations = 1000
+)
+
+// RankingMode selects the score users of a Graph are ranked by.
+type RankingMode string
+
+const (
+	// Number of interactions received, the community wide equivalent of
+	// UserInteractions.Ranked
+	RankByInteractions RankingMode = "interactions"
+	RankByPageRank     RankingMode = "pagerank"
+	// Number of distinct users interacting with the user
+	RankByInDegree RankingMode = "in-degree"
+	// Number of distinct users the user interacts with
+	RankByOutDegree   RankingMode = "out-degree"
+	RankByBetweenness RankingMode = "betweenness"
+	RankByEigenvector RankingMode = "eigenvector"
+)
+
+// RankingModes are all supported ranking modes.
+var RankingModes = []RankingMode{
+	RankByInteractions,
+	RankByPageRank,
+	RankByInDegree,
+	RankByOutDegree,
+	RankByBetweenness,
+	RankByEigenvector,
+}
+
+// Scores returns the score of every user of the graph for mode. Key is the user
+// id.
+func (g *Graph) Scores(mode RankingMode) (map[string]float64, error) {
+	switch mode {
+	case RankByInteractions:
+		return g.InteractionsReceived(), nil
+	case RankByPageRank:
+		return g.PageRank(DefaultPageRankDamping), nil
+	case RankByInDegree:
+		return g.InDegree(), nil
+	case RankByOutDegree:
+		return g.OutDegree(), nil
+	case RankByBetweenness:
+		return g.Betweenness(), nil
+	case RankByEigenvector:
+		return g.EigenvectorCentrality(), nil
+	}
+	return nil, fmt.Errorf("unknown ranking mode %q", mode)
+}
+
+// Ranked returns the user ids of the graph ranked by mode in descending order
+// of their scores, like UserInteractions.Ranked. Users with equal scores are
+// ordered by id. Second returned slice is the scores.
+func (g *Graph) Ranked(mode RankingMode) ([]string, []float64, error) {
+	scores, err := g.Scores(mode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userIds := g.NodeIds()
+	sort.SliceStable(userIds, func(i, j int) bool {
+		return scores[userIds[i]] > scores[userIds[j]]
+	})
+	values := make([]float64, len(userIds))
+	for i, id := range userIds {
+		values[i] = scores[id]
+	}
+	return userIds, values, nil
+}
+
+// InteractionsReceived returns the number of interactions of all kinds every
+// user received.
+func (g *Graph) InteractionsReceived() map[string]float64 {
+	ret := g.zeroScores()
+	for _, e := range g.Edges() {
+		ret[e.To] += float64(e.Count)
+	}
+	return ret
+}
+
+// InDegree returns the number of distinct users interacting with every user.
+// Unlike InteractionsReceived, many interactions of a single user count once.
+func (g *Graph) InDegree() map[string]float64 {
+	ret := g.zeroScores()
+	for id, from := range g.in {
+		ret[id] = float64(len(from))
+	}
+	return ret
+}
+
+// OutDegree returns the number of distinct users every user interacts with.
+func (g *Graph) OutDegree() map[string]float64 {
+	ret := g.zeroScores()
+	for id, to := range g.out {
+		ret[id] = float64(len(to))
+	}
+	return ret
+}
+
+// PageRank returns the weighted PageRank of every user, interactions are
+// followed proportionally to their counts. Users without interactions jump to
+// a random user. Scores sum up to 1.
+func (g *Graph) PageRank(damping float64) map[string]float64 {
+	adj := g.adjacency()
+	n := len(adj.ids)
+	if n == 0 {
+		return map[string]float64{}
+	}
+
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for iter := 0; iter < centralityMaxIterations; iter++ {
+		dangling := 0.0
+		for u := range adj.out {
+			if adj.outWeight[u] == 0 {
+				dangling += rank[u]
+			}
+		}
+
+		next := make([]float64, n)
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for v := range next {
+			next[v] = base
+		}
+		for u, edges := range adj.out {
+			for _, e := range edges {
+				next[e.to] += damping * rank[u] * e.weight / adj.outWeight[u]
+			}
+		}
+
+		diff := l1Distance(rank, next)
+		rank = next
+		if diff < centralityTolerance*float64(n) {
+			break
+		}
+	}
+	return adj.scores(rank)
+}
+
+// Betweenness returns the betweenness centrality of every user: the share of
+// shortest interaction paths between all other pairs of users which pass
+// through the user, normalized to [0, 1]. Paths are directed and every
+// interacting pair is one hop regardless of interaction counts.
+func (g *Graph) Betweenness() map[string]float64 {
+	adj := g.adjacency()
+	n := len(adj.ids)
+	centrality := make([]float64, n)
+
+	// Brandes' algorithm, single source shortest paths with BFS
+	for s := 0; s < n; s++ {
+		stack := []int{}
+		pred := make([][]int, n)
+		sigma := make([]float64, n)
+		dist := make([]int, n)
+		for i := range dist {
+			dist[i] = -1
+		}
+		sigma[s] = 1
+		dist[s] = 0
+
+		queue := []int{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, e := range adj.out[v] {
+				w := e.to
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					pred[w] = append(pred[w], v)
+				}
+			}
+		}
+
+		delta := make([]float64, n)
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range pred[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				centrality[w] += delta[w]
+			}
+		}
+	}
+
+	if n > 2 {
+		scale := 1 / float64((n-1)*(n-2))
+		for i := range centrality {
+			centrality[i] *= scale
+		}
+	}
+	return adj.scores(centrality)
+}
+
+// EigenvectorCentrality returns the weighted eigenvector centrality of every
+// user: users are central when they receive interactions from central users.
+// Scores are normalized to unit length.
+func (g *Graph) EigenvectorCentrality() map[string]float64 {
+	adj := g.adjacency()
+	n := len(adj.ids)
+	if n == 0 {
+		return map[string]float64{}
+	}
+
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = 1 / float64(n)
+	}
+	for iter := 0; iter < centralityMaxIterations; iter++ {
+		// Power iteration of (A + I), the shift keeps the iteration from
+		// oscillating on bipartite graphs without changing the eigenvector
+		next := make([]float64, n)
+		copy(next, x)
+		for u, edges := range adj.out {
+			for _, e := range edges {
+				next[e.to] += x[u] * e.weight
+			}
+		}
+
+		norm := 0.0
+		for _, v := range next {
+			norm += v * v
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			break
+		}
+		for i := range next {
+			next[i] /= norm
+		}
+
+		diff := l1Distance(x, next)
+		x = next
+		if diff < centralityTolerance*float64(n) {
+			break
+		}
+	}
+	return adj.scores(x)
+}
+
+// zeroScores returns a zero score for every user
+func (g *Graph) zeroScores() map[string]float64 {
+	ret := make(map[string]float64, len(g.nodes))
+	for id := range g.nodes {
+		ret[id] = 0
+	}
+	return ret
+}
+
+type weightedEdge struct {
+	to     int
+	weight float64
+}
+
+// graphAdjacency is an index based adjacency list of a Graph. Nodes and edges
+// are ordered by user id, so that floating point sums are deterministic.
+type graphAdjacency struct {
+	ids       []string
+	out       [][]weightedEdge
+	outWeight []float64
+}
+
+// adjacency returns the adjacency list of g, edges are weighted by the number
+// of interactions of all kinds
+func (g *Graph) adjacency() *graphAdjacency {
+	ids := g.NodeIds()
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	adj := &graphAdjacency{
+		ids:       ids,
+		out:       make([][]weightedEdge, len(ids)),
+		outWeight: make([]float64, len(ids)),
+	}
+	for u, id := range ids {
+		successors := g.Successors(id)
+		to := make([]string, 0, len(successors))
+		for v := range successors {
+			to = append(to, v)
+		}
+		sort.Strings(to)
+		for _, v := range to {
+			w := float64(successors[v])
+			adj.out[u] = append(adj.out[u], weightedEdge{to: index[v], weight: w})
+			adj.outWeight[u] += w
+		}
+	}
+	return adj
+}
+
+func (adj *graphAdjacency) scores(values []float64) map[string]float64 {
+	ret := make(map[string]float64, len(values))
+	for i, v := range values {
+		ret[adj.ids[i]] = v
+	}
+	return ret
+}
+
+func l1Distance(a, b []float64) float64 {
+	ret := 0.0
+	for i := range a {
+		ret += math.Abs(a[i] - b[i])
+	}
+	return ret
+}
@@ -0,0 +1,175 @@
+package twitter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// edges builds a graph from from -> to reply counts
+func edges(counts map[[2]string]uint) *Graph {
+	g := NewGraph()
+	for pair, count := range counts {
+		g.AddEdge(pair[0], pair[1], InteractionReply, count, time.Time{})
+	}
+	return g
+}
+
+func assertScores(t *testing.T, want, got map[string]float64) {
+	t.Helper()
+	require.Len(t, got, len(want))
+	for id, w := range want {
+		assert.InDelta(t, w, got[id], 1e-6, id)
+	}
+}
+
+func TestPageRank(t *testing.T) {
+	tests := []struct {
+		name string
+		g    *Graph
+		want map[string]float64
+	}{
+		{
+			name: "cycle",
+			g:    edges(map[[2]string]uint{{"1", "2"}: 1, {"2", "3"}: 1, {"3", "1"}: 1}),
+			want: map[string]float64{"1": 1.0 / 3, "2": 1.0 / 3, "3": 1.0 / 3},
+		},
+		{
+			// p1 = 0.15/2 + 0.85*p2/2, p2 = 1 - p1
+			name: "dangling user",
+			g:    edges(map[[2]string]uint{{"1", "2"}: 5}),
+			want: map[string]float64{"1": 0.5 / 1.425, "2": 1 - 0.5/1.425},
+		},
+		{
+			// p2 = p3 = 0.05 + 0.85*p1/2, p1 = 0.05 + 0.85*(p2+p3)
+			name: "star",
+			g:    edges(map[[2]string]uint{{"1", "2"}: 1, {"1", "3"}: 1, {"2", "1"}: 1, {"3", "1"}: 1}),
+			want: map[string]float64{"1": 0.4864865, "2": 0.2567568, "3": 0.2567568},
+		},
+		{
+			name: "empty",
+			g:    NewGraph(),
+			want: map[string]float64{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertScores(t, tc.want, tc.g.PageRank(DefaultPageRankDamping))
+		})
+	}
+
+	t.Run("weighted", func(t *testing.T) {
+		pr := edges(map[[2]string]uint{{"1", "2"}: 3, {"1", "3"}: 1, {"2", "1"}: 1, {"3", "1"}: 1}).PageRank(DefaultPageRankDamping)
+		assert.Greater(t, pr["2"], pr["3"])
+		assert.InDelta(t, 1, pr["1"]+pr["2"]+pr["3"], 1e-9)
+	})
+}
+
+func TestBetweenness(t *testing.T) {
+	tests := []struct {
+		name string
+		g    *Graph
+		want map[string]float64
+	}{
+		{
+			// Only pair 1 -> 3 passes through 2, of 2 possible pairs
+			name: "path",
+			g:    edges(map[[2]string]uint{{"1", "2"}: 1, {"2", "3"}: 1}),
+			want: map[string]float64{"1": 0, "2": 0.5, "3": 0},
+		},
+		{
+			// Two shortest paths 1 -> 4 share the pair, 6 possible pairs
+			name: "diamond",
+			g:    edges(map[[2]string]uint{{"1", "2"}: 1, {"1", "3"}: 1, {"2", "4"}: 1, {"3", "4"}: 1}),
+			want: map[string]float64{"1": 0, "2": 1.0 / 12, "3": 1.0 / 12, "4": 0},
+		},
+		{
+			// Counts do not change path lengths
+			name: "weighted path",
+			g:    edges(map[[2]string]uint{{"1", "2"}: 10, {"2", "3"}: 1, {"1", "3"}: 1}),
+			want: map[string]float64{"1": 0, "2": 0, "3": 0},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertScores(t, tc.want, tc.g.Betweenness())
+		})
+	}
+}
+
+func TestEigenvectorCentrality(t *testing.T) {
+	tests := []struct {
+		name string
+		g    *Graph
+		want map[string]float64
+	}{
+		{
+			name: "triangle",
+			g: edges(map[[2]string]uint{
+				{"1", "2"}: 1, {"2", "1"}: 1, {"2", "3"}: 1, {"3", "2"}: 1, {"1", "3"}: 1, {"3", "1"}: 1,
+			}),
+			want: map[string]float64{"1": 1 / math.Sqrt(3), "2": 1 / math.Sqrt(3), "3": 1 / math.Sqrt(3)},
+		},
+		{
+			// Center has sqrt(3) times the score of each leaf
+			name: "star",
+			g: edges(map[[2]string]uint{
+				{"1", "2"}: 1, {"2", "1"}: 1, {"1", "3"}: 1, {"3", "1"}: 1, {"1", "4"}: 1, {"4", "1"}: 1,
+			}),
+			want: map[string]float64{"1": 1 / math.Sqrt2, "2": 1 / math.Sqrt(6), "3": 1 / math.Sqrt(6), "4": 1 / math.Sqrt(6)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertScores(t, tc.want, tc.g.EigenvectorCentrality())
+		})
+	}
+}
+
+func TestGraphRanked(t *testing.T) {
+	// 9 spams 1, while 2 is replied to by 3 different users
+	g := edges(map[[2]string]uint{
+		{"9", "1"}: 50,
+		{"3", "2"}: 1, {"4", "2"}: 1, {"5", "2"}: 1,
+		{"2", "3"}: 1,
+	})
+
+	tests := []struct {
+		mode       RankingMode
+		wantTop    []string
+		wantScores []float64
+	}{
+		{RankByInteractions, []string{"1", "2", "3"}, []float64{50, 3, 1}},
+		{RankByInDegree, []string{"2", "1", "3"}, []float64{3, 1, 1}},
+		{RankByOutDegree, []string{"2", "3", "4"}, []float64{1, 1, 1}},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			userIds, scores, err := g.Ranked(tc.mode)
+			require.NoError(t, err)
+			require.Len(t, userIds, 6)
+			assert.Equal(t, tc.wantTop, userIds[:3])
+			assert.Equal(t, tc.wantScores, scores[:3])
+		})
+	}
+
+	t.Run("every mode", func(t *testing.T) {
+		for _, mode := range RankingModes {
+			userIds, _, err := g.Ranked(mode)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, g.NodeIds(), userIds, mode)
+		}
+		_, _, err := g.Ranked("followers")
+		assert.ErrorContains(t, err, "unknown ranking mode")
+	})
+
+	t.Run("pagerank", func(t *testing.T) {
+		// Spammed user is not ranked above the user of the community
+		userIds, _, err := g.Ranked(RankByPageRank)
+		require.NoError(t, err)
+		assert.Equal(t, "2", userIds[0])
+	})
+}
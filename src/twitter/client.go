@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
-// Twitter V2 API endpoint with trailing slash
+// Twitter V2 API endpoint with trailing slash. Default base url of the
+// clients, see WithBaseURL.
 const TwitterV2API = "https://api.twitter.com/2/"
 
 // Whenever HTTP 429 is returned from API, this error will be returned from
@@ -23,11 +27,27 @@ func (e *ErrRateLimited) Error() string {
 	return "rate limited"
 }
 
+// Endpoint identifies a Client API endpoint. It is used for per endpoint
+// configuration such as rate limiters.
+type Endpoint string
+
+const (
+	EndpointUserTweets      Endpoint = "users/:id/tweets"
+	EndpointUserLikedTweets Endpoint = "users/:id/liked_tweets"
+	EndpointTweetLikers     Endpoint = "tweets/:id/liking_users"
+	EndpointTweetRetweeters Endpoint = "tweets/:id/retweeted_by"
+	EndpointUserLookup      Endpoint = "users/by"
+)
+
 // Client queries twitter API endpoints and fetches API data. Client is not
 // responsible for any rate limiting or throttling. It only issues requests and
 // parses the responses. User is responsible for any error handling. Twitter API
 // is inherently quite restrictive and even processing something like 1000
 // tweets will get rate limited pretty fast.
+//
+// Failed API responses are returned as *ErrRateLimited for HTTP 429 and as
+// *ErrAPI for any other non 200 status. See IsUnauthorized, IsNotFound and
+// other helpers for checking the error kind.
 type Client interface {
 	// FetchUserTweets fetches timeline tweets which include tweets, retweets,
 	// replies, quote tweets for given userId
@@ -58,81 +78,262 @@ type Client interface {
 	FetchTweetRetweeters(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error)
 
 	// FindUserDetails is a helper method to find user ids by names.
-	FindUserDetails(userNames []string) (*UserLookupResponse, error)
+	// Additional user fields and the pinned tweet expansion can be
+	// requested with options.
+	FindUserDetails(userNames []string, options ...ApiRequestOption) (*UserLookupResponse, error)
 }
 
-func NewAuthBearerClient(authBearer string) *twitterHTTPClient {
-	r := resty.New()
-	r.SetHeader("Authorization", "Bearer "+authBearer)
+// ClientOption configures the http client created by the client constructors.
+type ClientOption func(*twitterHTTPClient)
 
-	return &twitterHTTPClient{
-		authBearer: authBearer,
-		r:          r,
+// WithRetryPolicy sets the retry policy for transient API failures. By default
+// DefaultRetryPolicy is used.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(t *twitterHTTPClient) {
+		t.retry = p
 	}
 }
 
-var _ Client = (*twitterHTTPClient)(nil)
+// WithBaseURL points the client to a different API url, for example a
+// recording proxy or a local fake server. Defaults to TwitterV2API. Endpoint
+// paths are appended to baseURL, so it should include the version path
+// ("/2/").
+func WithBaseURL(baseURL string) ClientOption {
+	return func(t *twitterHTTPClient) {
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+		t.baseURL = baseURL
+	}
+}
 
-// twitterHTTPClient is the basic http client for Twitter V2 API authenticating
-// with authBearer
-type twitterHTTPClient struct {
-	authBearer string
-	r          *resty.Client
+// WithTransport sets the http.RoundTripper used for all requests.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(t *twitterHTTPClient) {
+		t.r.SetTransport(transport)
+	}
 }
 
-func (t *twitterHTTPClient) sendGet(endpoint string, options ...ApiRequestOption) ([]byte, error) {
-	req := t.r.R()
+// WithTimeout sets the timeout of a single request attempt.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(t *twitterHTTPClient) {
+		t.r.SetTimeout(timeout)
+	}
+}
 
-	for _, opt := range options {
-		opt.Apply(req)
+// WithUserAgent sets the User-Agent header of all requests.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(t *twitterHTTPClient) {
+		t.r.SetHeader("User-Agent", userAgent)
+	}
+}
+
+// WithProxy routes all requests through proxyURL, for example
+// "http://proxy.internal:3128". Proxy can only be set on the default
+// transport, when combined with WithTransport, custom transport must handle
+// the proxy itself, see NewProxyTransport.
+func WithProxy(proxyURL string) ClientOption {
+	return func(t *twitterHTTPClient) {
+		t.r.SetProxy(proxyURL)
 	}
+}
 
-	resp, err := req.Get(endpoint)
+// NewProxyTransport returns a copy of http.DefaultTransport which routes all
+// requests through proxyURL. Use it as the underlying transport of wrapping
+// transports such as RecordingTransport.
+func NewProxyTransport(proxyURL string) (*http.Transport, error) {
+	u, err := url.Parse(proxyURL)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("parsing proxy url: %w", err)
 	}
-	body := resp.Body()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	return transport, nil
+}
 
-	fullEndpoint := endpoint + "?" + req.QueryParam.Encode()
-	slog.Info("sent a GET twitter API request",
-		slog.String("endpoint", fullEndpoint),
-		slog.Int("status", resp.StatusCode()),
-	)
+// NewAuthBearerClient creates a client authenticating with app-only bearer
+// token.
+func NewAuthBearerClient(authBearer string, options ...ClientOption) *twitterHTTPClient {
+	return newTwitterHTTPClient(&bearerAuth{token: authBearer}, options...)
+}
+
+func newTwitterHTTPClient(auth requestAuthenticator, options ...ClientOption) *twitterHTTPClient {
+	t := &twitterHTTPClient{
+		auth:    auth,
+		r:       resty.New(),
+		baseURL: TwitterV2API,
+		retry:   DefaultRetryPolicy(),
+		sleep:   time.Sleep,
+		now:     time.Now,
+	}
+
+	for _, opt := range options {
+		opt(t)
+	}
+
+	return t
+}
+
+var _ Client = (*twitterHTTPClient)(nil)
+
+// twitterHTTPClient is the basic http client for Twitter V2 API. Requests are
+// authenticated with auth.
+type twitterHTTPClient struct {
+	auth requestAuthenticator
+	r    *resty.Client
+
+	// API url with trailing slash, TwitterV2API by default
+	baseURL string
+
+	retry RetryPolicy
+
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// requestAuthenticator adds the credentials to outgoing API requests.
+type requestAuthenticator interface {
+	authenticate(req *resty.Request, method, endpoint string) error
+}
+
+// tokenRefresher is implemented by authenticators which can obtain a new
+// access token when API responds with HTTP 401.
+type tokenRefresher interface {
+	refreshToken() error
+}
+
+// bearerAuth authenticates requests with a static bearer token
+type bearerAuth struct {
+	token string
+}
+
+func (b *bearerAuth) authenticate(req *resty.Request, method, endpoint string) error {
+	req.SetAuthToken(b.token)
+	return nil
+}
+
+func (t *twitterHTTPClient) sendGet(endpoint string, options ...ApiRequestOption) ([]byte, error) {
+	return t.send(resty.MethodGet, endpoint, nil, options...)
+}
 
-	if resp.StatusCode() != 200 {
-		slog.Error(
-			"response failed",
+// sendPost sends body encoded as json
+func (t *twitterHTTPClient) sendPost(endpoint string, body any, options ...ApiRequestOption) ([]byte, error) {
+	return t.send(resty.MethodPost, endpoint, body, options...)
+}
+
+func (t *twitterHTTPClient) send(method, endpoint string, reqBody any, options ...ApiRequestOption) ([]byte, error) {
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		req := t.r.R()
+		if reqBody != nil {
+			req.SetBody(reqBody)
+		}
+
+		for _, opt := range options {
+			opt.Apply(req)
+		}
+
+		if err := t.auth.authenticate(req, method, endpoint); err != nil {
+			return nil, fmt.Errorf("authenticating request: %w", err)
+		}
+
+		fullEndpoint := endpoint + "?" + req.QueryParam.Encode()
+
+		resp, err := req.Execute(method, endpoint)
+		if err != nil {
+			if t.retry.shouldRetryError(method, attempt) {
+				wait := t.retry.backoff(attempt, "", t.now())
+				slog.Warn("twitter API request failed, retrying",
+					slog.String("endpoint", fullEndpoint),
+					slog.Int("attempt", attempt),
+					slog.Duration("wait_time", wait),
+					slog.String("error", err.Error()),
+				)
+				t.sleep(wait)
+				continue
+			}
+			return nil, err
+		}
+		body := resp.Body()
+
+		slog.Info("sent a "+method+" twitter API request",
 			slog.String("endpoint", fullEndpoint),
 			slog.Int("status", resp.StatusCode()),
-			slog.String("repsonse", string(body)),
 		)
 
-		// For rate limited requests -
-		if resp.StatusCode() == 429 {
-			resetTimeInt := int64(0)
-			// Check if reset timestamp is included in response
-			if resetTime := resp.Header().Get("x-rate-limit-reset"); resetTime != "" {
-				if ri, err := strconv.ParseInt(resetTime, 10, 64); err == nil {
-					resetTimeInt = ri
+		if !resp.IsSuccess() {
+			// Expired or revoked access token, obtain a new one and resend
+			// the request once.
+			if rf, ok := t.auth.(tokenRefresher); ok && resp.StatusCode() == 401 && !refreshed {
+				refreshed = true
+				err := rf.refreshToken()
+				if err == nil {
+					slog.Info("access token refreshed, resending request", slog.String("endpoint", fullEndpoint))
+					attempt--
+					continue
 				}
+				slog.Error("refreshing access token failed", slog.String("error", err.Error()))
+			}
+
+			if t.retry.shouldRetryStatus(method, resp.StatusCode(), attempt) {
+				wait := t.retry.backoff(attempt, resp.Header().Get("Retry-After"), t.now())
+				slog.Warn("twitter API request failed, retrying",
+					slog.String("endpoint", fullEndpoint),
+					slog.Int("attempt", attempt),
+					slog.Int("status", resp.StatusCode()),
+					slog.Duration("wait_time", wait),
+				)
+				t.sleep(wait)
+				continue
 			}
 
-			return nil, &ErrRateLimited{ResetTimestamp: resetTimeInt}
+			slog.Error(
+				"response failed",
+				slog.String("endpoint", fullEndpoint),
+				slog.Int("status", resp.StatusCode()),
+				slog.Int("attempt", attempt),
+				slog.String("repsonse", string(body)),
+			)
+
+			return nil, responseError(resp.StatusCode(), resp.Header(), body)
 		}
 
-		return nil, fmt.Errorf("response failed: %d", resp.StatusCode())
+		return body, nil
 	}
-
-	return body, nil
 }
 
-func (t *twitterHTTPClient) FindUserDetails(userNames []string) (*UserLookupResponse, error) {
-	endpoint := TwitterV2API + "users/by"
+// responseError converts a failed API response to ErrRateLimited or ErrAPI
+func responseError(status int, header http.Header, body []byte) error {
+	// For rate limited requests -
+	if status == 429 {
+		resetTimeInt := int64(0)
+		// Check if reset timestamp is included in response
+		if resetTime := header.Get("x-rate-limit-reset"); resetTime != "" {
+			if ri, err := strconv.ParseInt(resetTime, 10, 64); err == nil {
+				resetTimeInt = ri
+			}
+		}
+
+		return &ErrRateLimited{ResetTimestamp: resetTimeInt}
+	}
+
+	return newErrAPI(status, body)
+}
 
-	body, err := t.sendGet(endpoint, &OptApplyQueryParam{
-		Key:   "usernames",
-		Value: strings.Join(userNames, ","),
-	})
+func (t *twitterHTTPClient) FindUserDetails(userNames []string, options ...ApiRequestOption) (*UserLookupResponse, error) {
+	endpoint := t.baseURL + "users/by"
+	options = append(
+		options,
+		&OptApplyQueryParam{
+			Key:   "usernames",
+			Value: strings.Join(userNames, ","),
+		},
+		UserFields(UserFieldPublicMetrics),
+	)
+	if err := validateOptions(EndpointUserLookup, options); err != nil {
+		return nil, err
+	}
+	body, err := t.sendGet(endpoint, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -150,26 +351,26 @@ func (t *twitterHTTPClient) FindUserDetails(userNames []string) (*UserLookupResp
 // FetchUserTweets sends a user tweets request and parses it. Collected
 // iformation includes tweet text, tweet id, conversation id,
 func (t *twitterHTTPClient) FetchUserTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
-	endpoint := TwitterV2API + "users/" + userId + "/tweets"
-	body, err := t.sendGet(endpoint,
-		append(
-			options,
-			// Append the conversation_id expansion to get the information if
-			// tweet is a reply in conversation. For simple tweets the
-			// conversation_id should be the same tweet id
-			&OptApplyQueryParam{
-				Key:   "tweet.fields",
-				Value: "conversation_id,referenced_tweets",
-			},
-			// Append information about conversation tweet author
-			// (in_reply_to_user_id) and referenced tweets and author_id (any of
-			// these might be empty too if a tweet is just a simple tweet)
-			&OptApplyQueryParam{
-				Key:   "expansions",
-				Value: "in_reply_to_user_id,referenced_tweets.id,referenced_tweets.id.author_id",
-			},
-		)...,
+	endpoint := t.baseURL + "users/" + userId + "/tweets"
+	options = append(
+		options,
+		// Append the conversation_id expansion to get the information if
+		// tweet is a reply in conversation. For simple tweets the
+		// conversation_id should be the same tweet id
+		// Creation time and mentions are used for interaction time series,
+		// display text range tells the reply prefix apart from mentions
+		TweetFields(TweetFieldConversationID, TweetFieldReferencedTweets, TweetFieldPublicMetrics, TweetFieldCreatedAt, TweetFieldEntities, TweetFieldDisplayTextRange),
+		// Append information about conversation tweet author
+		// (in_reply_to_user_id) and referenced tweets and author_id (any of
+		// these might be empty too if a tweet is just a simple tweet)
+		Expansions(ExpansionInReplyToUserID, ExpansionReferencedTweetsID, ExpansionReferencedTweetsIDAuthorID),
+		// Follower counts of the expanded users
+		UserFields(UserFieldPublicMetrics),
 	)
+	if err := validateOptions(EndpointUserTweets, options); err != nil {
+		return nil, err
+	}
+	body, err := t.sendGet(endpoint, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -189,17 +390,18 @@ func (t *twitterHTTPClient) FetchUserTweets(userId string, options ...ApiRequest
 // includes.users. Tweet author ids are the most important for data processing.
 // Up to 100 results per request.
 func (t *twitterHTTPClient) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
-	endpoint := TwitterV2API + "users/" + userId + "/liked_tweets"
-	body, err := t.sendGet(endpoint,
-		append(
-			options,
-			// Append information about conversation tweet author user id
-			&OptApplyQueryParam{
-				Key:   "expansions",
-				Value: "author_id",
-			},
-		)...,
+	endpoint := t.baseURL + "users/" + userId + "/liked_tweets"
+	options = append(
+		options,
+		// Append information about conversation tweet author user id
+		Expansions(ExpansionAuthorID),
+		TweetFields(TweetFieldPublicMetrics, TweetFieldCreatedAt),
+		UserFields(UserFieldPublicMetrics),
 	)
+	if err := validateOptions(EndpointUserLikedTweets, options); err != nil {
+		return nil, err
+	}
+	body, err := t.sendGet(endpoint, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -216,7 +418,11 @@ func (t *twitterHTTPClient) FetchUserLikedTweets(userId string, options ...ApiRe
 
 // FetchTweetLikers finds the users who liked given tweetId tweet. Limitations
 func (t twitterHTTPClient) FetchTweetLikers(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
-	endpoint := TwitterV2API + "tweets/" + tweetId + "/liking_users"
+	endpoint := t.baseURL + "tweets/" + tweetId + "/liking_users"
+	options = append(options, UserFields(UserFieldPublicMetrics))
+	if err := validateOptions(EndpointTweetLikers, options); err != nil {
+		return nil, err
+	}
 	body, err := t.sendGet(endpoint, options...)
 	if err != nil {
 		return nil, err
@@ -233,7 +439,11 @@ func (t twitterHTTPClient) FetchTweetLikers(tweetId string, options ...ApiReques
 }
 
 func (t twitterHTTPClient) FetchTweetRetweeters(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
-	endpoint := TwitterV2API + "tweets/" + tweetId + "/retweeted_by"
+	endpoint := t.baseURL + "tweets/" + tweetId + "/retweeted_by"
+	options = append(options, UserFields(UserFieldPublicMetrics))
+	if err := validateOptions(EndpointTweetRetweeters, options); err != nil {
+		return nil, err
+	}
 	body, err := t.sendGet(endpoint, options...)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,84 @@
+package twitter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingTransport counts requests passed to the default transport
+type countingTransport struct {
+	count atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.count.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientOptions(t *testing.T) {
+	usersBody := []byte(`{"data":[{"id":"1","name":"Name","username":"user"}]}`)
+
+	t.Run("base url, user agent and transport", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/2/users/by", r.URL.Path)
+			assert.Equal(t, "interactions-bot/1.0", r.Header.Get("User-Agent"))
+			w.Write(usersBody)
+		}))
+		defer srv.Close()
+
+		transport := &countingTransport{}
+		c := NewAuthBearerClient("bearer",
+			WithBaseURL(srv.URL+"/api/2"),
+			WithUserAgent("interactions-bot/1.0"),
+			WithTransport(transport),
+		)
+
+		_, err := c.FindUserDetails([]string{"user"})
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), transport.count.Load())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond * 200)
+			w.Write(usersBody)
+		}))
+		defer srv.Close()
+
+		c := NewAuthBearerClient("bearer",
+			WithBaseURL(srv.URL+"/2/"),
+			WithTimeout(time.Millisecond*20),
+			WithRetryPolicy(NoRetryPolicy()),
+		)
+
+		_, err := c.FindUserDetails([]string{"user"})
+		assert.Error(t, err)
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		proxied := atomic.Int32{}
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied.Add(1)
+			// Proxy receives the absolute url of the upstream API
+			assert.Equal(t, "api.twitter.test", r.URL.Host)
+			assert.Equal(t, "/2/users/by", r.URL.Path)
+			w.Write(usersBody)
+		}))
+		defer proxy.Close()
+
+		c := NewAuthBearerClient("bearer",
+			WithBaseURL("http://api.twitter.test/2/"),
+			WithProxy(proxy.URL),
+		)
+
+		_, err := c.FindUserDetails([]string{"user"})
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), proxied.Load())
+	})
+}
@@ -0,0 +1,238 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// CrawlCheckpoint are the interactions of already crawled users. It is saved
+// after every crawled user so that an interrupted crawl can be resumed.
+type CrawlCheckpoint struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	// Key is the crawled user id
+	Results map[string]*UserInteractions `json:"results"`
+	// Users which can not be analyzed, key is the user id and value the error
+	Skipped map[string]string `json:"skipped,omitempty"`
+}
+
+// LoadCrawlCheckpoint reads the checkpoint at path. An empty checkpoint is
+// returned when the file does not exist.
+func LoadCrawlCheckpoint(path string) (*CrawlCheckpoint, error) {
+	cp := &CrawlCheckpoint{Results: map[string]*UserInteractions{}, Skipped: map[string]string{}}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, cp); err != nil {
+		return nil, fmt.Errorf("parsing crawl checkpoint: %w", err)
+	}
+	if cp.Results == nil {
+		cp.Results = map[string]*UserInteractions{}
+	}
+	if cp.Skipped == nil {
+		cp.Skipped = map[string]string{}
+	}
+	return cp, nil
+}
+
+// Save writes the checkpoint to path.
+func (cp *CrawlCheckpoint) Save(path string) error {
+	contents, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// CrawlResult is the ego network assembled by Crawler.
+type CrawlResult struct {
+	SeedUserId string
+	// Graph of the interactions of all crawled users
+	Graph *Graph
+	// Hop distance from the seed of every crawled user, key is the user id
+	Crawled map[string]int
+	// Protected, suspended or deleted users which were skipped, key is the
+	// user id and value the error
+	Skipped map[string]string
+}
+
+// Crawler builds the ego network of a seed user. The seed is analyzed first,
+// then the top Breadth counterparts of every crawled user are analyzed, hop by
+// hop, until Depth hops from the seed are covered. Every user is analyzed
+// once. All users are analyzed with the same Analyzer, so its rate limiters
+// apply to the whole crawl.
+type Crawler struct {
+	Analyzer *Analyzer
+	Logger   *slog.Logger
+
+	// Radius of the ego network. Users up to Depth-1 hops from the seed are
+	// analyzed, so that their interactions reach Depth hops. Depth 2 is the
+	// two-hop network of the seed's counterparts and their counterparts.
+	Depth int
+
+	// Number of top ranked counterparts of every analyzed user which are
+	// analyzed in the next hop
+	Breadth int
+
+	// File the crawl progress is saved to after every analyzed user. Users
+	// found in an existing checkpoint are not analyzed again. Empty disables
+	// checkpoints.
+	CheckpointPath string
+}
+
+func NewCrawler(a *Analyzer) *Crawler {
+	return &Crawler{
+		Analyzer: a,
+		Logger:   slog.Default(),
+		Depth:    2,
+		Breadth:  10,
+	}
+}
+
+// Crawl builds the ego network of seedUserId. When ctx is cancelled the crawl
+// stops after the user being analyzed and the progress is kept in the
+// checkpoint. Users whose data can not be accessed (protected, suspended or
+// deleted users) are checkpointed as skipped and the crawl continues. Any
+// other failed analysis stops the crawl, the user is not checkpointed and is
+// analyzed again when the crawl is resumed.
+func (c *Crawler) Crawl(ctx context.Context, seedUserId string) (*CrawlResult, error) {
+	cp := &CrawlCheckpoint{Results: map[string]*UserInteractions{}, Skipped: map[string]string{}}
+	if c.CheckpointPath != "" {
+		var err error
+		if cp, err = LoadCrawlCheckpoint(c.CheckpointPath); err != nil {
+			return nil, err
+		}
+		if len(cp.Results) > 0 {
+			c.Logger.Info("resuming crawl from checkpoint",
+				slog.String("path", c.CheckpointPath),
+				slog.Int("crawled_users", len(cp.Results)),
+			)
+		}
+	}
+
+	ret := &CrawlResult{
+		SeedUserId: seedUserId,
+		Graph:      NewGraph(),
+		Crawled:    map[string]int{},
+		Skipped:    map[string]string{},
+	}
+	hop := []string{seedUserId}
+	for distance := 0; distance < max(c.Depth, 1) && len(hop) > 0; distance++ {
+		next := []string{}
+		for _, userId := range hop {
+			if _, ok := ret.Crawled[userId]; ok {
+				continue
+			}
+			if reason, ok := cp.Skipped[userId]; ok {
+				ret.Skipped[userId] = reason
+				continue
+			}
+
+			result, ok := cp.Results[userId]
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				c.Logger.Info("crawling user",
+					slog.String("user_id", userId),
+					slog.Int("hop", distance),
+				)
+				var err error
+				result, err = c.Analyzer.CreateUserInteractionGraph(userId)
+				if err != nil && isUnavailableUser(err) {
+					c.Logger.Warn("skipping unavailable user",
+						slog.String("user_id", userId),
+						slog.String("error", err.Error()),
+					)
+					cp.Skipped[userId] = err.Error()
+					ret.Skipped[userId] = err.Error()
+					if err := c.saveCheckpoint(cp); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("analyzing user %s: %w", userId, err)
+				}
+				cp.Results[userId] = result
+				if err := c.saveCheckpoint(cp); err != nil {
+					return nil, err
+				}
+			}
+
+			ret.Crawled[userId] = distance
+			ret.Graph.mergeUserInteractions(result)
+			next = append(next, topCounterparts(result, c.Breadth)...)
+		}
+		hop = next
+	}
+
+	c.Logger.Info("crawl finished",
+		slog.String("seed_user_id", seedUserId),
+		slog.Int("crawled_users", len(ret.Crawled)),
+		slog.Int("skipped_users", len(ret.Skipped)),
+		slog.Int("users", ret.Graph.NodeCount()),
+		slog.Int("edges", ret.Graph.EdgeCount()),
+	)
+	return ret, nil
+}
+
+func (c *Crawler) saveCheckpoint(cp *CrawlCheckpoint) error {
+	if c.CheckpointPath == "" {
+		return nil
+	}
+	cp.UpdatedAt = time.Now().UTC()
+	if err := cp.Save(c.CheckpointPath); err != nil {
+		return fmt.Errorf("saving crawl checkpoint: %w", err)
+	}
+	return nil
+}
+
+// isUnavailableUser returns true when every error joined in err is caused by
+// a user whose data can not be accessed, so that retrying does not help
+func isUnavailableUser(err error) bool {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		if !IsForbiddenProtectedUser(e) && !IsNotFound(e) && !IsUnauthorized(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// topCounterparts returns up to k most interacted user ids of u. Ties are
+// ordered by user id, so that a resumed crawl visits the same users.
+func topCounterparts(u *UserInteractions, k int) []string {
+	ranked := u.RankedUsers()
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Interactions != ranked[j].Interactions {
+			return ranked[i].Interactions > ranked[j].Interactions
+		}
+		return ranked[i].UserId < ranked[j].UserId
+	})
+
+	ret := make([]string, 0, min(k, len(ranked)))
+	for i := 0; i < len(ranked) && i < k; i++ {
+		ret = append(ret, ranked[i].UserId)
+	}
+	return ret
+}
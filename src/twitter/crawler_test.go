@@ -0,0 +1,240 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usersClient serves the timeline of every user from replies, key is the
+// replying user id and value the replied to user ids. Timelines of the users
+// in fail return the error.
+type usersClient struct {
+	Client
+	replies map[string][]string
+	fail    map[string]error
+
+	mu      sync.Mutex
+	fetched []string
+}
+
+func (c *usersClient) FetchUserTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	c.mu.Lock()
+	c.fetched = append(c.fetched, userId)
+	c.mu.Unlock()
+
+	if err := c.fail[userId]; err != nil {
+		return nil, err
+	}
+	resp := &TweetsResponse{}
+	for i, to := range c.replies[userId] {
+		resp.Data = append(resp.Data, Tweet{
+			TweetId:         fmt.Sprintf("%s-%d", userId, i),
+			AuthorUserId:    userId,
+			InReplyToUserId: to,
+		})
+	}
+	return resp, nil
+}
+
+func (c *usersClient) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	return &TweetsResponse{}, nil
+}
+
+func newTestCrawler(c Client, depth, breadth int) *Crawler {
+	a := &Analyzer{
+		Client:                 c,
+		Logger:                 slog.Default(),
+		MaxTweetsPerRequest:    100,
+		UserTweetsToFetch:      100,
+		UserLikedTweetsToFetch: 100,
+		TimelineLimiter:        NewRateLimiter(100, time.Minute),
+		LikedTweetsLimiter:     NewRateLimiter(100, time.Minute),
+	}
+	cr := NewCrawler(a)
+	cr.Depth = depth
+	cr.Breadth = breadth
+	return cr
+}
+
+func TestCrawler(t *testing.T) {
+	replies := map[string][]string{
+		// 3 and 4 are tied, 3 is crawled by the lower id
+		"1": {"2", "2", "2", "4", "3", "3", "4"},
+		"2": {"1", "5"},
+		"3": {"2", "6"},
+		"5": {"7"},
+	}
+
+	tests := []struct {
+		name        string
+		depth       int
+		breadth     int
+		wantCrawled map[string]int
+		wantNodes   []string
+	}{
+		{
+			name:        "seed only",
+			depth:       1,
+			breadth:     2,
+			wantCrawled: map[string]int{"1": 0},
+			wantNodes:   []string{"1", "2", "3", "4"},
+		},
+		{
+			name:        "two hops",
+			depth:       2,
+			breadth:     2,
+			wantCrawled: map[string]int{"1": 0, "2": 1, "3": 1},
+			wantNodes:   []string{"1", "2", "3", "4", "5", "6"},
+		},
+		{
+			// Seed is not crawled again as counterpart of 2
+			name:        "three hops",
+			depth:       3,
+			breadth:     2,
+			wantCrawled: map[string]int{"1": 0, "2": 1, "3": 1, "5": 2, "6": 2},
+			wantNodes:   []string{"1", "2", "3", "4", "5", "6", "7"},
+		},
+		{
+			name:        "narrow",
+			depth:       3,
+			breadth:     1,
+			wantCrawled: map[string]int{"1": 0, "2": 1},
+			wantNodes:   []string{"1", "2", "3", "4", "5"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &usersClient{replies: replies}
+			result, err := newTestCrawler(c, tc.depth, tc.breadth).Crawl(context.Background(), "1")
+			require.NoError(t, err)
+
+			assert.Equal(t, "1", result.SeedUserId)
+			assert.Equal(t, tc.wantCrawled, result.Crawled)
+			assert.Equal(t, tc.wantNodes, result.Graph.NodeIds())
+			// Every user is fetched once
+			assert.Len(t, c.fetched, len(tc.wantCrawled))
+		})
+	}
+
+	t.Run("graph", func(t *testing.T) {
+		result, err := newTestCrawler(&usersClient{replies: replies}, 2, 2).Crawl(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint(3), result.Graph.Weight("1", "2"))
+		assert.Equal(t, uint(1), result.Graph.Weight("2", "1"))
+		assert.Equal(t, uint(1), result.Graph.Weight("3", "6"))
+	})
+}
+
+func TestCrawlerResume(t *testing.T) {
+	replies := map[string][]string{
+		"1": {"2", "3"},
+		"2": {"4"},
+		"3": {"4"},
+	}
+	path := filepath.Join(t.TempDir(), "crawl.json")
+
+	// Interrupted after the seed was analyzed
+	seed := NewUserInteractionsObject()
+	seed.UserTwitterId = "1"
+	seed.RepliesToOtherUsers = map[string]uint{"2": 1, "3": 1}
+	require.NoError(t, (&CrawlCheckpoint{Results: map[string]*UserInteractions{"1": seed}}).Save(path))
+
+	c := &usersClient{replies: replies}
+	cr := newTestCrawler(c, 2, 2)
+	cr.CheckpointPath = path
+	result, err := cr.Crawl(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"1": 0, "2": 1, "3": 1}, result.Crawled)
+	assert.Equal(t, []string{"2", "3"}, c.fetched)
+
+	cp, err := LoadCrawlCheckpoint(path)
+	require.NoError(t, err)
+	assert.Len(t, cp.Results, 3)
+	assert.Equal(t, map[string]uint{"4": 1}, cp.Results["2"].RepliesToOtherUsers)
+
+	t.Run("completed crawl is not fetched again", func(t *testing.T) {
+		c := &usersClient{replies: replies}
+		cr := newTestCrawler(c, 2, 2)
+		cr.CheckpointPath = path
+		resumed, err := cr.Crawl(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Empty(t, c.fetched)
+		assert.Equal(t, result.Graph.Edges(), resumed.Graph.Edges())
+	})
+
+	t.Run("failed user is retried", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "crawl.json")
+		cr := newTestCrawler(&usersClient{replies: replies, fail: map[string]error{"3": &ErrAPI{StatusCode: 503}}}, 2, 2)
+		cr.CheckpointPath = path
+		_, err := cr.Crawl(context.Background(), "1")
+		assert.ErrorContains(t, err, "analyzing user 3")
+
+		cp, err := LoadCrawlCheckpoint(path)
+		require.NoError(t, err)
+		assert.NotContains(t, cp.Results, "3")
+
+		c := &usersClient{replies: replies}
+		cr = newTestCrawler(c, 2, 2)
+		cr.CheckpointPath = path
+		resumed, err := cr.Crawl(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"3"}, c.fetched)
+		assert.Equal(t, result.Graph.Edges(), resumed.Graph.Edges())
+	})
+
+	t.Run("unavailable user is skipped", func(t *testing.T) {
+		for name, fail := range map[string]error{
+			"not found": &ErrAPI{StatusCode: 404},
+			"protected": &ErrAPI{StatusCode: 403, Errors: []ProblemDetail{{Type: ProblemNotAuthorizedForResource}}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "crawl.json")
+				cr := newTestCrawler(&usersClient{replies: replies, fail: map[string]error{"3": fail}}, 2, 2)
+				cr.CheckpointPath = path
+				skipped, err := cr.Crawl(context.Background(), "1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]int{"1": 0, "2": 1}, skipped.Crawled)
+				assert.Equal(t, map[string]string{"3": "fetching user-timeline-tweets: " + fail.Error()}, skipped.Skipped)
+				// Seed's interactions with the skipped user are kept
+				assert.Equal(t, uint(1), skipped.Graph.Weight("1", "3"))
+
+				// Skipped user is not analyzed again
+				c := &usersClient{replies: replies}
+				cr = newTestCrawler(c, 2, 2)
+				cr.CheckpointPath = path
+				resumed, err := cr.Crawl(context.Background(), "1")
+				require.NoError(t, err)
+				assert.Empty(t, c.fetched)
+				assert.Equal(t, skipped.Skipped, resumed.Skipped)
+				assert.Equal(t, skipped.Graph.Edges(), resumed.Graph.Edges())
+			})
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cr := newTestCrawler(&usersClient{replies: replies}, 2, 2)
+		cr.CheckpointPath = filepath.Join(t.TempDir(), "crawl.json")
+		_, err := cr.Crawl(ctx, "1")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("invalid checkpoint", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "crawl.json")
+		require.NoError(t, os.WriteFile(bad, []byte("{"), 0o600))
+		cr := newTestCrawler(&usersClient{replies: replies}, 2, 2)
+		cr.CheckpointPath = bad
+		_, err := cr.Crawl(context.Background(), "1")
+		assert.ErrorContains(t, err, "parsing crawl checkpoint")
+	})
+}
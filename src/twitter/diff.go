@@ -0,0 +1,125 @@
+package twitter
+
+import "sort"
+
+// CategoryDeltas are per-category interaction count changes.
+type CategoryDeltas struct {
+	Replies  int `json:"replies"`
+	Retweets int `json:"retweets"`
+	Likes    int `json:"likes"`
+}
+
+// RankChange describes how a single interacted user moved between two runs.
+type RankChange struct {
+	UserId   string `json:"user_id"`
+	Username string `json:"username,omitempty"`
+
+	// Ranks start at 1, users with the same number of interactions share
+	// the rank. 0 when the user is not ranked in the run.
+	OldRank int `json:"old_rank"`
+	NewRank int `json:"new_rank"`
+	// RankDelta is positive when the user moved up
+	RankDelta int `json:"rank_delta"`
+
+	OldInteractions uint           `json:"old_interactions"`
+	NewInteractions uint           `json:"new_interactions"`
+	Deltas          CategoryDeltas `json:"deltas"`
+}
+
+// InteractionsDiff is the difference between an older and a newer
+// UserInteractions of the same user.
+type InteractionsDiff struct {
+	// Users ranked only in the new run, by new rank
+	NewEntrants []RankChange `json:"new_entrants"`
+	// Users ranked only in the old run, by old rank
+	Dropouts []RankChange `json:"dropouts"`
+	// Users ranked in both runs, by new rank
+	Changed []RankChange `json:"changed"`
+}
+
+// DiffInteractions compares two interaction results and reports new
+// entrants, dropouts, rank changes and per-category count changes.
+func DiffInteractions(older, newer *UserInteractions) *InteractionsDiff {
+	oldRanks, oldTotals := competitionRanks(older)
+	newRanks, newTotals := competitionRanks(newer)
+
+	diff := &InteractionsDiff{
+		NewEntrants: []RankChange{},
+		Dropouts:    []RankChange{},
+		Changed:     []RankChange{},
+	}
+
+	users := map[string]bool{}
+	for userId := range oldRanks {
+		users[userId] = true
+	}
+	for userId := range newRanks {
+		users[userId] = true
+	}
+
+	for userId := range users {
+		c := RankChange{
+			UserId:          userId,
+			Username:        newer.Usernames[userId],
+			OldRank:         oldRanks[userId],
+			NewRank:         newRanks[userId],
+			OldInteractions: oldTotals[userId],
+			NewInteractions: newTotals[userId],
+			Deltas: CategoryDeltas{
+				Replies:  int(newer.RepliesToOtherUsers[userId]) - int(older.RepliesToOtherUsers[userId]),
+				Retweets: int(newer.RetweetsToOtherUsers[userId]) - int(older.RetweetsToOtherUsers[userId]),
+				Likes:    int(newer.UserLikedTweets[userId]) - int(older.UserLikedTweets[userId]),
+			},
+		}
+		if c.Username == "" {
+			c.Username = older.Usernames[userId]
+		}
+
+		switch {
+		case c.OldRank == 0:
+			diff.NewEntrants = append(diff.NewEntrants, c)
+		case c.NewRank == 0:
+			diff.Dropouts = append(diff.Dropouts, c)
+		default:
+			c.RankDelta = c.OldRank - c.NewRank
+			diff.Changed = append(diff.Changed, c)
+		}
+	}
+
+	byRank := func(changes []RankChange, rank func(RankChange) int) {
+		sort.Slice(changes, func(i, j int) bool {
+			if rank(changes[i]) != rank(changes[j]) {
+				return rank(changes[i]) < rank(changes[j])
+			}
+			return changes[i].UserId < changes[j].UserId
+		})
+	}
+	newRank := func(c RankChange) int { return c.NewRank }
+	byRank(diff.NewEntrants, newRank)
+	byRank(diff.Changed, newRank)
+	byRank(diff.Dropouts, func(c RankChange) int { return c.OldRank })
+
+	return diff
+}
+
+// competitionRanks ranks users by interactions, users with equal interactions
+// share the rank ("1224" ranking) so ranks do not depend on map order
+func competitionRanks(u *UserInteractions) (map[string]int, map[string]uint) {
+	userIds, values := u.Ranked()
+
+	ranks := make(map[string]int, len(userIds))
+	totals := make(map[string]uint, len(userIds))
+	for i, userId := range userIds {
+		totals[userId] = values[i]
+		if values[i] == 0 {
+			continue
+		}
+		// Ranked orders by interactions, ties are adjacent
+		rank := i + 1
+		if i > 0 && values[i-1] == values[i] {
+			rank = ranks[userIds[i-1]]
+		}
+		ranks[userId] = rank
+	}
+	return ranks, totals
+}
@@ -0,0 +1,40 @@
+package twitter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffInteractions(t *testing.T) {
+	older := NewUserInteractionsObject()
+	older.RepliesToOtherUsers = map[string]uint{"a": 5, "b": 2}
+	older.UserLikedTweets = map[string]uint{"c": 2, "d": 1}
+	older.Usernames = map[string]string{"d": "dropped"}
+
+	newer := NewUserInteractionsObject()
+	newer.RepliesToOtherUsers = map[string]uint{"a": 1, "b": 2}
+	newer.RetweetsToOtherUsers = map[string]uint{"b": 4, "e": 3}
+	newer.UserLikedTweets = map[string]uint{"c": 2}
+	newer.Usernames = map[string]string{"b": "bee", "e": "new"}
+
+	diff := DiffInteractions(older, newer)
+
+	assert.Equal(t, []RankChange{
+		{UserId: "b", Username: "bee", OldRank: 2, NewRank: 1, RankDelta: 1, OldInteractions: 2, NewInteractions: 6, Deltas: CategoryDeltas{Retweets: 4}},
+		// b and c were tied in the old run
+		{UserId: "c", OldRank: 2, NewRank: 3, RankDelta: -1, OldInteractions: 2, NewInteractions: 2},
+		{UserId: "a", OldRank: 1, NewRank: 4, RankDelta: -3, OldInteractions: 5, NewInteractions: 1, Deltas: CategoryDeltas{Replies: -4}},
+	}, diff.Changed)
+	assert.Equal(t, []RankChange{
+		{UserId: "e", Username: "new", NewRank: 2, NewInteractions: 3, Deltas: CategoryDeltas{Retweets: 3}},
+	}, diff.NewEntrants)
+	assert.Equal(t, []RankChange{
+		{UserId: "d", Username: "dropped", OldRank: 4, OldInteractions: 1, Deltas: CategoryDeltas{Likes: -1}},
+	}, diff.Dropouts)
+
+	empty := DiffInteractions(NewUserInteractionsObject(), NewUserInteractionsObject())
+	assert.Empty(t, empty.Changed)
+	assert.Empty(t, empty.NewEntrants)
+	assert.Empty(t, empty.Dropouts)
+}
@@ -0,0 +1,153 @@
+package twitter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Problem type URIs returned by Twitter V2 API. See
+// https://developer.twitter.com/en/support/twitter-api/error-troubleshooting
+const (
+	problemTypePrefix = "https://api.twitter.com/2/problems/"
+
+	ProblemInvalidRequest           = problemTypePrefix + "invalid-request"
+	ProblemResourceNotFound         = problemTypePrefix + "resource-not-found"
+	ProblemNotAuthorizedForResource = problemTypePrefix + "not-authorized-for-resource"
+	ProblemClientForbidden          = problemTypePrefix + "client-forbidden"
+	ProblemUsageCapped              = problemTypePrefix + "usage-capped"
+)
+
+// ProblemDetail is a single entry of the errors array returned by the API.
+// Depending on the error, either the problem fields (title, detail, type,
+// resource_*) or the invalid request fields (message, parameters) are set.
+type ProblemDetail struct {
+	Title        string `json:"title"`
+	Detail       string `json:"detail"`
+	Type         string `json:"type"`
+	Value        string `json:"value"`
+	Section      string `json:"section"`
+	ResourceType string `json:"resource_type"`
+	ResourceId   string `json:"resource_id"`
+	Parameter    string `json:"parameter"`
+
+	// Id of the conflicting object, for example the existing stream rule
+	// of a DuplicateRule problem
+	Id string `json:"id"`
+
+	Message    string              `json:"message"`
+	Parameters map[string][]string `json:"parameters"`
+}
+
+// ShortType returns the problem type without the URI prefix, for example
+// "resource-not-found".
+func (p ProblemDetail) ShortType() string {
+	return strings.TrimPrefix(p.Type, problemTypePrefix)
+}
+
+// ErrAPI is returned from Client func calls whenever API responds with a non
+// 200 status code (except for HTTP 429, see ErrRateLimited). It carries the
+// parsed problem details body.
+type ErrAPI struct {
+	StatusCode int
+
+	// Problem type URI, for example ProblemClientForbidden
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	// Reason is set for client-forbidden problems, for example
+	// "client-not-enrolled"
+	Reason string `json:"reason"`
+
+	// Per-field errors
+	Errors []ProblemDetail `json:"errors"`
+
+	// Body is the raw response body
+	Body []byte `json:"-"`
+}
+
+func (e *ErrAPI) Error() string {
+	msg := fmt.Sprintf("response failed: %d", e.StatusCode)
+	if e.Title != "" {
+		msg += " " + e.Title
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, pd := range e.Errors {
+		if pd.Message != "" {
+			msg += "; " + pd.Message
+		} else if pd.Detail != "" {
+			msg += "; " + pd.Detail
+		}
+	}
+	return msg
+}
+
+// HasProblemType returns true when either the top level problem or any of the
+// per-field errors are of given problemType.
+func (e *ErrAPI) HasProblemType(problemType string) bool {
+	if e.Type == problemType {
+		return true
+	}
+	for _, pd := range e.Errors {
+		if pd.Type == problemType {
+			return true
+		}
+	}
+	return false
+}
+
+// newErrAPI parses the problem details body. Unparsable bodies (for example
+// html error pages from proxies) are still returned as ErrAPI with only status
+// and Body set.
+func newErrAPI(statusCode int, body []byte) *ErrAPI {
+	e := &ErrAPI{}
+	if err := json.Unmarshal(body, e); err != nil {
+		e = &ErrAPI{}
+	}
+	e.StatusCode = statusCode
+	e.Body = body
+
+	return e
+}
+
+// asErrAPI unwraps ErrAPI from err.
+func asErrAPI(err error) (*ErrAPI, bool) {
+	e := &ErrAPI{}
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// IsUnauthorized returns true when err is an API error caused by invalid or
+// expired credentials.
+func IsUnauthorized(err error) bool {
+	e, ok := asErrAPI(err)
+	return ok && e.StatusCode == http.StatusUnauthorized
+}
+
+// IsNotFound returns true when err is an API error for a non existing
+// resource, for example deleted tweet or non existing user.
+func IsNotFound(err error) bool {
+	e, ok := asErrAPI(err)
+	return ok && (e.StatusCode == http.StatusNotFound || e.HasProblemType(ProblemResourceNotFound))
+}
+
+// IsForbiddenProtectedUser returns true when err is caused by requesting the
+// data of a protected or suspended user which the authenticated client is not
+// allowed to see.
+func IsForbiddenProtectedUser(err error) bool {
+	e, ok := asErrAPI(err)
+	return ok && e.HasProblemType(ProblemNotAuthorizedForResource)
+}
+
+// IsClientNotEnrolled returns true when the app used for authentication is not
+// attached to a project or its access level does not allow the endpoint.
+func IsClientNotEnrolled(err error) bool {
+	e, ok := asErrAPI(err)
+	return ok && e.HasProblemType(ProblemClientForbidden) && e.Reason == "client-not-enrolled"
+}
@@ -0,0 +1,112 @@
+package twitter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewErrAPI(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectErr   *ErrAPI
+		expectCheck func(*testing.T, error)
+	}{
+		{
+			name:   "unauthorized",
+			status: 401,
+			body:   `{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`,
+			expectErr: &ErrAPI{
+				StatusCode: 401,
+				Type:       "about:blank",
+				Title:      "Unauthorized",
+				Detail:     "Unauthorized",
+			},
+			expectCheck: func(t *testing.T, err error) {
+				assert.True(t, IsUnauthorized(err))
+				assert.False(t, IsNotFound(err))
+				assert.False(t, IsClientNotEnrolled(err))
+			},
+		},
+		{
+			name:   "client not enrolled",
+			status: 403,
+			body:   `{"client_id":"123","detail":"When authenticating requests to the Twitter API v2 endpoints, you must use keys and tokens from a Twitter developer App that is attached to a Project.","registration_url":"https://developer.twitter.com/en/docs/projects/overview","title":"Client Forbidden","required_enrollment":"Appropriate Level of API Access","reason":"client-not-enrolled","type":"https://api.twitter.com/2/problems/client-forbidden"}`,
+			expectErr: &ErrAPI{
+				StatusCode: 403,
+				Type:       ProblemClientForbidden,
+				Title:      "Client Forbidden",
+				Detail:     "When authenticating requests to the Twitter API v2 endpoints, you must use keys and tokens from a Twitter developer App that is attached to a Project.",
+				Reason:     "client-not-enrolled",
+			},
+			expectCheck: func(t *testing.T, err error) {
+				assert.True(t, IsClientNotEnrolled(err))
+				assert.False(t, IsUnauthorized(err))
+				assert.False(t, IsForbiddenProtectedUser(err))
+			},
+		},
+		{
+			name:   "invalid request with per-field errors",
+			status: 400,
+			body:   `{"errors":[{"parameters":{"id":["abc"]},"message":"The ` + "`id`" + ` query parameter value [abc] is not valid"}],"title":"Invalid Request","detail":"One or more parameters to your request was invalid.","type":"https://api.twitter.com/2/problems/invalid-request"}`,
+			expectErr: &ErrAPI{
+				StatusCode: 400,
+				Type:       ProblemInvalidRequest,
+				Title:      "Invalid Request",
+				Detail:     "One or more parameters to your request was invalid.",
+				Errors: []ProblemDetail{
+					{
+						Message:    "The `id` query parameter value [abc] is not valid",
+						Parameters: map[string][]string{"id": {"abc"}},
+					},
+				},
+			},
+		},
+		{
+			name:   "protected user",
+			status: 403,
+			body:   `{"errors":[{"detail":"Sorry, you are not authorized to see the user with id: [123].","title":"Authorization Error","resource_type":"user","parameter":"id","resource_id":"123","type":"https://api.twitter.com/2/problems/not-authorized-for-resource"}]}`,
+			expectErr: &ErrAPI{
+				StatusCode: 403,
+				Errors: []ProblemDetail{
+					{
+						Detail:       "Sorry, you are not authorized to see the user with id: [123].",
+						Title:        "Authorization Error",
+						ResourceType: "user",
+						Parameter:    "id",
+						ResourceId:   "123",
+						Type:         ProblemNotAuthorizedForResource,
+					},
+				},
+			},
+			expectCheck: func(t *testing.T, err error) {
+				assert.True(t, IsForbiddenProtectedUser(err))
+			},
+		},
+		{
+			name:   "not json body",
+			status: 502,
+			body:   `<html>Bad Gateway</html>`,
+			expectErr: &ErrAPI{
+				StatusCode: 502,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newErrAPI(tt.status, []byte(tt.body))
+
+			tt.expectErr.Body = []byte(tt.body)
+			assert.Equal(t, tt.expectErr, got)
+
+			if tt.expectCheck != nil {
+				// Helpers must unwrap wrapped errors too
+				tt.expectCheck(t, fmt.Errorf("wrapped: %w", got))
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package twitter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// TweetField is a tweet.fields value. See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/tweet
+type TweetField string
+
+const (
+	TweetFieldAttachments       TweetField = "attachments"
+	TweetFieldAuthorID          TweetField = "author_id"
+	TweetFieldConversationID    TweetField = "conversation_id"
+	TweetFieldCreatedAt         TweetField = "created_at"
+	TweetFieldDisplayTextRange  TweetField = "display_text_range"
+	TweetFieldEntities          TweetField = "entities"
+	TweetFieldGeo               TweetField = "geo"
+	TweetFieldInReplyToUserID   TweetField = "in_reply_to_user_id"
+	TweetFieldLang              TweetField = "lang"
+	TweetFieldPossiblySensitive TweetField = "possibly_sensitive"
+	TweetFieldPublicMetrics     TweetField = "public_metrics"
+	TweetFieldReferencedTweets  TweetField = "referenced_tweets"
+	TweetFieldSource            TweetField = "source"
+)
+
+// UserField is a user.fields value. See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/user
+type UserField string
+
+const (
+	UserFieldCreatedAt       UserField = "created_at"
+	UserFieldDescription     UserField = "description"
+	UserFieldLocation        UserField = "location"
+	UserFieldPinnedTweetID   UserField = "pinned_tweet_id"
+	UserFieldProfileImageURL UserField = "profile_image_url"
+	UserFieldProtected       UserField = "protected"
+	UserFieldPublicMetrics   UserField = "public_metrics"
+	UserFieldURL             UserField = "url"
+	UserFieldVerified        UserField = "verified"
+)
+
+// MediaField is a media.fields value. See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/media
+type MediaField string
+
+const (
+	MediaFieldAltText         MediaField = "alt_text"
+	MediaFieldDurationMs      MediaField = "duration_ms"
+	MediaFieldHeight          MediaField = "height"
+	MediaFieldPreviewImageURL MediaField = "preview_image_url"
+	MediaFieldPublicMetrics   MediaField = "public_metrics"
+	MediaFieldURL             MediaField = "url"
+	MediaFieldWidth           MediaField = "width"
+)
+
+// Expansion is an expansions value. See
+// https://developer.twitter.com/en/docs/twitter-api/expansions
+type Expansion string
+
+const (
+	ExpansionAttachmentsMediaKeys       Expansion = "attachments.media_keys"
+	ExpansionAttachmentsPollIDs         Expansion = "attachments.poll_ids"
+	ExpansionAuthorID                   Expansion = "author_id"
+	ExpansionEntitiesMentionsUsername   Expansion = "entities.mentions.username"
+	ExpansionGeoPlaceID                 Expansion = "geo.place_id"
+	ExpansionInReplyToUserID            Expansion = "in_reply_to_user_id"
+	ExpansionReferencedTweetsID         Expansion = "referenced_tweets.id"
+	ExpansionReferencedTweetsIDAuthorID Expansion = "referenced_tweets.id.author_id"
+	ExpansionPinnedTweetID              Expansion = "pinned_tweet_id"
+)
+
+// Query parameter names of fields and expansions
+const (
+	paramTweetFields = "tweet.fields"
+	paramUserFields  = "user.fields"
+	paramMediaFields = "media.fields"
+	paramExpansions  = "expansions"
+)
+
+func mergeOption[T ~string](key string, values []T) ApiRequestOption {
+	o := &OptMergeQueryParam{Key: key}
+	for _, v := range values {
+		o.Values = append(o.Values, string(v))
+	}
+	return o
+}
+
+// TweetFields requests additional tweet fields. Fields are merged with the
+// fields required by the client.
+func TweetFields(fields ...TweetField) ApiRequestOption {
+	return mergeOption(paramTweetFields, fields)
+}
+
+// UserFields requests additional user fields of returned or expanded users.
+func UserFields(fields ...UserField) ApiRequestOption {
+	return mergeOption(paramUserFields, fields)
+}
+
+// MediaFields requests media fields of expanded media. Requires
+// ExpansionAttachmentsMediaKeys expansion.
+func MediaFields(fields ...MediaField) ApiRequestOption {
+	return mergeOption(paramMediaFields, fields)
+}
+
+// Expansions requests additional expansions. Expansions are merged with the
+// expansions required by the client.
+func Expansions(expansions ...Expansion) ApiRequestOption {
+	return mergeOption(paramExpansions, expansions)
+}
+
+// tweetExpansions are expansions supported by endpoints returning tweets
+var tweetExpansions = []Expansion{
+	ExpansionAttachmentsMediaKeys,
+	ExpansionAttachmentsPollIDs,
+	ExpansionAuthorID,
+	ExpansionEntitiesMentionsUsername,
+	ExpansionGeoPlaceID,
+	ExpansionInReplyToUserID,
+	ExpansionReferencedTweetsID,
+	ExpansionReferencedTweetsIDAuthorID,
+}
+
+// userExpansions are expansions supported by endpoints returning users
+var userExpansions = []Expansion{
+	ExpansionPinnedTweetID,
+}
+
+// endpointExpansions lists supported expansions of each endpoint
+var endpointExpansions = map[Endpoint][]Expansion{
+	EndpointUserTweets:      tweetExpansions,
+	EndpointUserLikedTweets: tweetExpansions,
+	EndpointTweetLikers:     userExpansions,
+	EndpointTweetRetweeters: userExpansions,
+	EndpointUserLookup:      userExpansions,
+	EndpointSearchStream:    tweetExpansions,
+	EndpointSampleStream:    tweetExpansions,
+}
+
+// validateOptions checks the fields and expansions set by options are valid
+// for endpoint, so that invalid combinations fail before spending a request.
+func validateOptions(endpoint Endpoint, options []ApiRequestOption) error {
+	req := resty.New().R()
+	for _, opt := range options {
+		opt.Apply(req)
+	}
+
+	expansions := map[Expansion]bool{}
+	for _, e := range strings.Split(req.QueryParam.Get(paramExpansions), ",") {
+		if e == "" {
+			continue
+		}
+		expansion := Expansion(e)
+		if !slices.Contains(endpointExpansions[endpoint], expansion) {
+			return fmt.Errorf("expansion %s is not supported by %s endpoint", e, endpoint)
+		}
+		expansions[expansion] = true
+	}
+
+	if req.QueryParam.Get(paramMediaFields) != "" && !expansions[ExpansionAttachmentsMediaKeys] {
+		return fmt.Errorf("%s requires %s expansion", paramMediaFields, ExpansionAttachmentsMediaKeys)
+	}
+
+	// Users endpoints return tweets only as the expanded pinned tweet
+	returnsUsers := slices.Contains(endpointExpansions[endpoint], ExpansionPinnedTweetID)
+	if req.QueryParam.Get(paramTweetFields) != "" && returnsUsers && !expansions[ExpansionPinnedTweetID] {
+		return fmt.Errorf("%s requires %s expansion on %s endpoint", paramTweetFields, ExpansionPinnedTweetID, endpoint)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package twitter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldOptionsMergeWithDefaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "created_at,public_metrics,conversation_id,referenced_tweets,entities,display_text_range", q.Get("tweet.fields"))
+		assert.Equal(t, "attachments.media_keys,in_reply_to_user_id,referenced_tweets.id,referenced_tweets.id.author_id", q.Get("expansions"))
+		assert.Equal(t, "url", q.Get("media.fields"))
+		assert.Equal(t, "public_metrics", q.Get("user.fields"))
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	c := NewAuthBearerClient("bearer", WithBaseURL(srv.URL+"/2/"))
+	_, err := c.FetchUserTweets("1",
+		// Plain query param is merged with the defaults as well
+		&OptApplyQueryParam{Key: "tweet.fields", Value: "created_at"},
+		TweetFields(TweetFieldPublicMetrics, TweetFieldConversationID),
+		Expansions(ExpansionAttachmentsMediaKeys),
+		MediaFields(MediaFieldURL),
+		UserFields(UserFieldPublicMetrics),
+	)
+	require.NoError(t, err)
+}
+
+func TestFindUserDetailsOptions(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		assert.Equal(t, "user", q.Get("usernames"))
+		assert.Equal(t, "description,public_metrics", q.Get("user.fields"))
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	c := NewAuthBearerClient("bearer", WithBaseURL(srv.URL+"/2/"))
+	_, err := c.FindUserDetails([]string{"user"}, UserFields(UserFieldDescription))
+	require.NoError(t, err)
+
+	// Invalid combinations fail without a request
+	_, err = c.FindUserDetails([]string{"user"}, TweetFields(TweetFieldCreatedAt))
+	assert.ErrorContains(t, err, "tweet.fields requires pinned_tweet_id expansion")
+	assert.Equal(t, 1, requests)
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		options  []ApiRequestOption
+		wantErr  string
+	}{
+		{
+			name:     "tweet fields and expansions",
+			endpoint: EndpointUserTweets,
+			options:  []ApiRequestOption{TweetFields(TweetFieldCreatedAt), Expansions(ExpansionAuthorID)},
+		},
+		{
+			name:     "media fields with media expansion",
+			endpoint: EndpointUserLikedTweets,
+			options:  []ApiRequestOption{MediaFields(MediaFieldURL), Expansions(ExpansionAttachmentsMediaKeys)},
+		},
+		{
+			name:     "media fields without media expansion",
+			endpoint: EndpointUserLikedTweets,
+			options:  []ApiRequestOption{MediaFields(MediaFieldURL)},
+			wantErr:  "media.fields requires attachments.media_keys expansion",
+		},
+		{
+			name:     "tweet expansion on users endpoint",
+			endpoint: EndpointTweetLikers,
+			options:  []ApiRequestOption{Expansions(ExpansionAuthorID)},
+			wantErr:  "expansion author_id is not supported by tweets/:id/liking_users endpoint",
+		},
+		{
+			name:     "tweet fields on users endpoint require pinned tweet",
+			endpoint: EndpointTweetRetweeters,
+			options:  []ApiRequestOption{TweetFields(TweetFieldCreatedAt)},
+			wantErr:  "tweet.fields requires pinned_tweet_id expansion",
+		},
+		{
+			name:     "pinned tweet fields on users endpoint",
+			endpoint: EndpointTweetRetweeters,
+			options:  []ApiRequestOption{TweetFields(TweetFieldCreatedAt), Expansions(ExpansionPinnedTweetID), UserFields(UserFieldPublicMetrics)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateOptions(tc.endpoint, tc.options)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package twitter
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// GraphNode is a user of the interaction Graph.
+type GraphNode struct {
+	Id string `json:"id"`
+	// Username is empty when the user was not included in any response
+	Username string `json:"username,omitempty"`
+	// Public metrics of the user, nil when they were not returned by the API
+	Metrics *UserPublicMetrics `json:"metrics,omitempty"`
+}
+
+// GraphEdge are the interactions of a single kind of user From with user To.
+type GraphEdge struct {
+	From  string          `json:"from"`
+	To    string          `json:"to"`
+	Kind  InteractionKind `json:"kind"`
+	Count uint            `json:"count"`
+	// Time of the first and last interaction, zero when only counts without
+	// timestamps were added
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// Graph is a directed, weighted interaction graph of many users. Edges are
+// labelled with the InteractionKind, a pair of users has at most one edge per
+// kind and direction. A graph is built either from UserInteractions or from
+// events, never both, so that interactions are not counted twice. Quote and
+// mention edges only exist in graphs built from events, UserInteractions
+// count quotes as retweets and do not count mentions. Graph is not safe for
+// concurrent use.
+type Graph struct {
+	nodes map[string]*GraphNode
+	// From -> to -> kind
+	out map[string]map[string]map[InteractionKind]*GraphEdge
+	// To -> from, index for InEdges
+	in map[string]map[string]bool
+	// Analyzed users whose UserInteractions were merged
+	merged map[string]bool
+}
+
+// NewGraph returns an empty graph, edges are added with AddEdge.
+func NewGraph() *Graph {
+	return &Graph{
+		nodes:  map[string]*GraphNode{},
+		out:    map[string]map[string]map[InteractionKind]*GraphEdge{},
+		in:     map[string]map[string]bool{},
+		merged: map[string]bool{},
+	}
+}
+
+// NewGraphFromInteractions returns the graph of the interactions of the
+// analyzed users of results, together with the usernames and metrics of the
+// interacted users. Retweets include quotes and are added as
+// InteractionRetweet. Only the first result of every analyzed user is added,
+// pass a single result per user (for example its latest run).
+func NewGraphFromInteractions(results ...*UserInteractions) *Graph {
+	g := NewGraph()
+	for _, u := range results {
+		g.mergeUserInteractions(u)
+	}
+	return g
+}
+
+// NewGraphFromEvents returns the graph of events, every event is a single
+// interaction at the event time. Identical events, for example of a tweet
+// archived by several runs, are added once.
+func NewGraphFromEvents(events []InteractionEvent) *Graph {
+	g := NewGraph()
+	seen := map[InteractionEvent]bool{}
+	for _, ev := range events {
+		if seen[ev] {
+			continue
+		}
+		seen[ev] = true
+		g.AddEdge(ev.UserId, ev.CounterpartId, ev.Kind, 1, ev.At)
+	}
+	return g
+}
+
+// AddNode adds user id to the graph. Username is updated when not empty.
+func (g *Graph) AddNode(id, username string) *GraphNode {
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &GraphNode{Id: id}
+		g.nodes[id] = n
+	}
+	if username != "" {
+		n.Username = username
+	}
+	return n
+}
+
+// AddEdge adds count interactions of kind from user from to user to at time
+// at. Zero at adds the count without a timestamp. Self interactions are
+// ignored.
+func (g *Graph) AddEdge(from, to string, kind InteractionKind, count uint, at time.Time) {
+	if from == to || count == 0 {
+		return
+	}
+	g.AddNode(from, "")
+	g.AddNode(to, "")
+
+	if g.out[from] == nil {
+		g.out[from] = map[string]map[InteractionKind]*GraphEdge{}
+	}
+	if g.out[from][to] == nil {
+		g.out[from][to] = map[InteractionKind]*GraphEdge{}
+	}
+	if g.in[to] == nil {
+		g.in[to] = map[string]bool{}
+	}
+	g.in[to][from] = true
+
+	e, ok := g.out[from][to][kind]
+	if !ok {
+		e = &GraphEdge{From: from, To: to, Kind: kind}
+		g.out[from][to][kind] = e
+	}
+	e.Count += count
+	if !at.IsZero() {
+		if e.FirstAt.IsZero() || at.Before(e.FirstAt) {
+			e.FirstAt = at
+		}
+		if at.After(e.LastAt) {
+			e.LastAt = at
+		}
+	}
+}
+
+// mergeUserInteractions adds the interactions of the analyzed user of u,
+// users which were already merged are skipped
+func (g *Graph) mergeUserInteractions(u *UserInteractions) {
+	if g.merged[u.UserTwitterId] {
+		return
+	}
+	g.merged[u.UserTwitterId] = true
+	g.AddNode(u.UserTwitterId, "")
+	for kind, counts := range map[InteractionKind]map[string]uint{
+		InteractionReply:   u.RepliesToOtherUsers,
+		InteractionRetweet: u.RetweetsToOtherUsers,
+		InteractionLike:    u.UserLikedTweets,
+	} {
+		for to, count := range counts {
+			g.AddEdge(u.UserTwitterId, to, kind, count, time.Time{})
+		}
+	}
+
+	for id, username := range u.Usernames {
+		if _, ok := g.nodes[id]; ok {
+			g.AddNode(id, username)
+		}
+	}
+	for id, m := range u.UserMetrics {
+		if n, ok := g.nodes[id]; ok {
+			m := m
+			n.Metrics = &m
+		}
+	}
+}
+
+// Node returns the node of user id, nil when the user is not in the graph.
+func (g *Graph) Node(id string) *GraphNode {
+	return g.nodes[id]
+}
+
+// Nodes returns all nodes ordered by id.
+func (g *Graph) Nodes() []GraphNode {
+	ret := make([]GraphNode, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		ret = append(ret, *n)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Id < ret[j].Id
+	})
+	return ret
+}
+
+// NodeIds returns the ids of all nodes in ascending order.
+func (g *Graph) NodeIds() []string {
+	ret := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ret = append(ret, id)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Edges returns all edges ordered by from, to and kind.
+func (g *Graph) Edges() []GraphEdge {
+	ret := []GraphEdge{}
+	for from := range g.out {
+		ret = append(ret, g.OutEdges(from)...)
+	}
+	sortEdges(ret)
+	return ret
+}
+
+// OutEdges returns the edges of interactions made by user id ordered by to and
+// kind.
+func (g *Graph) OutEdges(id string) []GraphEdge {
+	ret := []GraphEdge{}
+	for _, kinds := range g.out[id] {
+		for _, e := range kinds {
+			ret = append(ret, *e)
+		}
+	}
+	sortEdges(ret)
+	return ret
+}
+
+// InEdges returns the edges of interactions received by user id ordered by
+// from and kind.
+func (g *Graph) InEdges(id string) []GraphEdge {
+	ret := []GraphEdge{}
+	for from := range g.in[id] {
+		for _, e := range g.out[from][id] {
+			ret = append(ret, *e)
+		}
+	}
+	sortEdges(ret)
+	return ret
+}
+
+// Edge returns the edge of kind from user from to user to, nil when there is
+// no such interaction.
+func (g *Graph) Edge(from, to string, kind InteractionKind) *GraphEdge {
+	return g.out[from][to][kind]
+}
+
+// Weight returns the number of interactions of the given kinds from user from
+// to user to. All kinds are counted when none are given.
+func (g *Graph) Weight(from, to string, kinds ...InteractionKind) uint {
+	var ret uint
+	for kind, e := range g.out[from][to] {
+		if len(kinds) == 0 || slices.Contains(kinds, kind) {
+			ret += e.Count
+		}
+	}
+	return ret
+}
+
+// Successors returns the users user id interacted with and the number of
+// interactions of all kinds with each of them.
+func (g *Graph) Successors(id string) map[string]uint {
+	ret := make(map[string]uint, len(g.out[id]))
+	for to := range g.out[id] {
+		ret[to] = g.Weight(id, to)
+	}
+	return ret
+}
+
+// Filter returns a copy of the graph with only the edges of the given kinds.
+// All nodes are kept.
+func (g *Graph) Filter(kinds ...InteractionKind) *Graph {
+	ret := NewGraph()
+	for id, n := range g.nodes {
+		node := *n
+		ret.nodes[id] = &node
+	}
+	for _, e := range g.Edges() {
+		if slices.Contains(kinds, e.Kind) {
+			ret.AddEdge(e.From, e.To, e.Kind, e.Count, e.FirstAt)
+			if !e.LastAt.IsZero() {
+				ret.Edge(e.From, e.To, e.Kind).LastAt = e.LastAt
+			}
+		}
+	}
+	return ret
+}
+
+// NodeCount returns the number of users in the graph.
+func (g *Graph) NodeCount() int {
+	return len(g.nodes)
+}
+
+// EdgeCount returns the number of edges in the graph.
+func (g *Graph) EdgeCount() int {
+	ret := 0
+	for _, to := range g.out {
+		for _, kinds := range to {
+			ret += len(kinds)
+		}
+	}
+	return ret
+}
+
+func sortEdges(edges []GraphEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		if edges[i].To != edges[j].To {
+			return edges[i].To < edges[j].To
+		}
+		return edges[i].Kind < edges[j].Kind
+	})
+}
@@ -0,0 +1,90 @@
+package twitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphMergeUserInteractions(t *testing.T) {
+	first := NewUserInteractionsObject()
+	first.UserTwitterId = "1"
+	first.RepliesToOtherUsers["2"] = 3
+	first.RetweetsToOtherUsers["3"] = 1
+	first.UserLikedTweets["2"] = 2
+	first.Usernames["2"] = "two"
+	first.UserMetrics["3"] = UserPublicMetrics{FollowersCount: 10}
+
+	// Analyzed users are interacted users of each other
+	second := NewUserInteractionsObject()
+	second.UserTwitterId = "2"
+	second.RepliesToOtherUsers["1"] = 1
+	second.UserLikedTweets["3"] = 4
+	second.Usernames["1"] = "one"
+
+	// A second result of the same user is not counted again
+	g := NewGraphFromInteractions(first, second, first)
+
+	assert.Equal(t, []string{"1", "2", "3"}, g.NodeIds())
+	assert.Equal(t, []GraphNode{
+		{Id: "1", Username: "one"},
+		{Id: "2", Username: "two"},
+		{Id: "3", Metrics: &UserPublicMetrics{FollowersCount: 10}},
+	}, g.Nodes())
+	assert.Equal(t, []GraphEdge{
+		{From: "1", To: "2", Kind: InteractionLike, Count: 2},
+		{From: "1", To: "2", Kind: InteractionReply, Count: 3},
+		{From: "1", To: "3", Kind: InteractionRetweet, Count: 1},
+		{From: "2", To: "1", Kind: InteractionReply, Count: 1},
+		{From: "2", To: "3", Kind: InteractionLike, Count: 4},
+	}, g.Edges())
+	assert.Equal(t, 5, g.EdgeCount())
+
+	assert.Equal(t, uint(5), g.Weight("1", "2"))
+	assert.Equal(t, uint(3), g.Weight("1", "2", InteractionReply, InteractionRetweet))
+	assert.Equal(t, uint(0), g.Weight("3", "1"))
+	assert.Equal(t, map[string]uint{"2": 5, "3": 1}, g.Successors("1"))
+	assert.Empty(t, g.Successors("3"))
+
+	assert.Equal(t, []GraphEdge{
+		{From: "1", To: "3", Kind: InteractionRetweet, Count: 1},
+		{From: "2", To: "3", Kind: InteractionLike, Count: 4},
+	}, g.InEdges("3"))
+	assert.Empty(t, g.OutEdges("3"))
+	assert.Nil(t, g.Edge("3", "1", InteractionLike))
+	assert.Nil(t, g.Node("404"))
+}
+
+func TestGraphEvents(t *testing.T) {
+	g := NewGraphFromEvents([]InteractionEvent{
+		{UserId: "1", CounterpartId: "2", Kind: InteractionMention, TweetId: "3", At: day(3)},
+		{UserId: "1", CounterpartId: "2", Kind: InteractionMention, TweetId: "1", At: day(1)},
+		{UserId: "1", CounterpartId: "2", Kind: InteractionMention, TweetId: "2", At: day(2)},
+		// Same tweet read twice
+		{UserId: "1", CounterpartId: "2", Kind: InteractionMention, TweetId: "2", At: day(2)},
+		{UserId: "1", CounterpartId: "2", Kind: InteractionQuote, TweetId: "5", At: day(5)},
+		{UserId: "2", CounterpartId: "2", Kind: InteractionReply, TweetId: "6", At: day(5)},
+	})
+	// Counts without timestamps keep the known range
+	g.AddEdge("1", "2", InteractionMention, 2, time.Time{})
+
+	e := g.Edge("1", "2", InteractionMention)
+	require.NotNil(t, e)
+	assert.Equal(t, GraphEdge{From: "1", To: "2", Kind: InteractionMention, Count: 5, FirstAt: day(1), LastAt: day(3)}, *e)
+	// Self interactions are ignored
+	assert.Empty(t, g.OutEdges("2"))
+
+	t.Run("filter", func(t *testing.T) {
+		quotes := g.Filter(InteractionQuote)
+		assert.Equal(t, []string{"1", "2"}, quotes.NodeIds())
+		assert.Equal(t, []GraphEdge{
+			{From: "1", To: "2", Kind: InteractionQuote, Count: 1, FirstAt: day(5), LastAt: day(5)},
+		}, quotes.Edges())
+
+		// Original is not modified
+		assert.Equal(t, 2, g.EdgeCount())
+		assert.Equal(t, uint(0), g.Filter().Weight("1", "2"))
+	})
+}
@@ -60,6 +60,20 @@ func (t *TwitterRateLimiter) Allow() bool {
 	return false
 }
 
+// Remaining returns the number of requests which can still run in the current
+// time window.
+func (t *TwitterRateLimiter) Remaining() int {
+	t.shouldReset()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.currentRequestCount >= t.requests {
+		return 0
+	}
+	return t.requests - t.currentRequestCount
+}
+
 // WaitTime returns the duration after which a next request can run.
 func (t *TwitterRateLimiter) WaitTime() time.Duration {
 	if t.currentRequestCount >= t.requests {
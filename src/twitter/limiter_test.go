@@ -46,6 +46,32 @@ func TestTwitterRateLimiter(t *testing.T) {
 		}
 	})
 
+	t.Run("returns remaining requests", func(t *testing.T) {
+		l := NewRateLimiter(10, time.Minute*15)
+		if l.Remaining() != 10 {
+			t.Errorf("Expected 10 remaining requests")
+		}
+
+		for i := 0; i < 4; i++ {
+			l.Allow()
+		}
+		if l.Remaining() != 6 {
+			t.Errorf("Expected 6 remaining requests")
+		}
+
+		l.MarkLimited()
+		if l.Remaining() != 0 {
+			t.Errorf("Expected 0 remaining requests")
+		}
+
+		l.now = func() time.Time {
+			return time.Now().Add(time.Minute * 16)
+		}
+		if l.Remaining() != 10 {
+			t.Errorf("Expected 10 remaining requests after time window")
+		}
+	})
+
 	// Returns correct wait time
 	t.Run("returns correct wait time", func(t *testing.T) {
 		l := NewRateLimiter(10, time.Minute*15)
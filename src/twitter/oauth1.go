@@ -0,0 +1,174 @@
+package twitter
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// OAuth1Credentials are the OAuth 1.0a consumer keys of the app and the user
+// access token. See
+// https://developer.twitter.com/en/docs/authentication/oauth-1-0a
+type OAuth1Credentials struct {
+	ConsumerKey       string
+	ConsumerSecret    string
+	AccessToken       string
+	AccessTokenSecret string
+}
+
+// NewOAuth1Client creates a client which signs every request with OAuth 1.0a
+// HMAC-SHA1 signature in user context of creds.AccessToken.
+func NewOAuth1Client(creds OAuth1Credentials, options ...ClientOption) *twitterHTTPClient {
+	return newTwitterHTTPClient(&oauth1Auth{
+		creds: creds,
+		nonce: oauth1Nonce,
+		now:   time.Now,
+	}, options...)
+}
+
+// oauth1Auth signs requests with OAuth 1.0a Authorization header
+type oauth1Auth struct {
+	creds OAuth1Credentials
+
+	nonce func() string
+	now   func() time.Time
+}
+
+func (o *oauth1Auth) authenticate(req *resty.Request, method, endpoint string) error {
+	params := url.Values{}
+	for k, v := range req.QueryParam {
+		params[k] = append(params[k], v...)
+	}
+	// Form encoded body parameters are part of the signature as well
+	for k, v := range req.FormData {
+		params[k] = append(params[k], v...)
+	}
+
+	header, err := o.authorizationHeader(method, endpoint, params)
+	if err != nil {
+		return err
+	}
+
+	req.SetHeader("Authorization", header)
+	return nil
+}
+
+// authorizationHeader creates the signed OAuth Authorization header value for
+// request to rawURL with given query and body params.
+func (o *oauth1Auth) authorizationHeader(method, rawURL string, params url.Values) (string, error) {
+	oauthParams := map[string]string{
+		"oauth_consumer_key":     o.creds.ConsumerKey,
+		"oauth_nonce":            o.nonce(),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(o.now().Unix(), 10),
+		"oauth_token":            o.creds.AccessToken,
+		"oauth_version":          "1.0",
+	}
+
+	signingParams := url.Values{}
+	for k, v := range params {
+		signingParams[k] = v
+	}
+	for k, v := range oauthParams {
+		signingParams.Set(k, v)
+	}
+
+	signature, err := oauth1Signature(method, rawURL, signingParams, o.creds.ConsumerSecret, o.creds.AccessTokenSecret)
+	if err != nil {
+		return "", err
+	}
+	oauthParams["oauth_signature"] = signature
+
+	keys := make([]string, 0, len(oauthParams))
+	for k := range oauthParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = percentEncode(k) + `="` + percentEncode(oauthParams[k]) + `"`
+	}
+
+	return "OAuth " + strings.Join(parts, ", "), nil
+}
+
+// oauth1Signature computes the HMAC-SHA1 signature of a request. params must
+// include all query, body and oauth_* parameters. See
+// https://developer.twitter.com/en/docs/authentication/oauth-1-0a/creating-a-signature
+func oauth1Signature(method, rawURL string, params url.Values, consumerSecret, tokenSecret string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing request url: %w", err)
+	}
+
+	// Query parameters included in the url are signed as well
+	all := url.Values{}
+	for k, v := range u.Query() {
+		all[k] = append(all[k], v...)
+	}
+	for k, v := range params {
+		all[k] = append(all[k], v...)
+	}
+
+	type pair struct{ k, v string }
+	pairs := []pair{}
+	for k, values := range all {
+		for _, v := range values {
+			pairs = append(pairs, pair{percentEncode(k), percentEncode(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].k == pairs[j].k {
+			return pairs[i].v < pairs[j].v
+		}
+		return pairs[i].k < pairs[j].k
+	})
+
+	paramStrings := make([]string, len(pairs))
+	for i, p := range pairs {
+		paramStrings[i] = p.k + "=" + p.v
+	}
+
+	baseURL := strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + u.EscapedPath()
+	base := strings.ToUpper(method) + "&" + percentEncode(baseURL) + "&" + percentEncode(strings.Join(paramStrings, "&"))
+	key := percentEncode(consumerSecret) + "&" + percentEncode(tokenSecret)
+
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// percentEncode encodes s as defined in RFC 3986 section 2.1, only unreserved
+// characters are left as is.
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// oauth1Nonce returns a random alphanumeric nonce
+func oauth1Nonce() string {
+	n, err := randomURLString(32)
+	if err != nil {
+		// crypto/rand should never fail, fall back to timestamp based nonce
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return strings.NewReplacer("-", "", "_", "").Replace(n)
+}
@@ -0,0 +1,132 @@
+package twitter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Credentials from the Twitter docs signature examples
+var docsOAuth1Credentials = OAuth1Credentials{
+	ConsumerKey:       "xvz1evFS4wEEPTGEFPHBog",
+	ConsumerSecret:    "kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+	AccessToken:       "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+	AccessTokenSecret: "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE",
+}
+
+func newDocsOAuth1Auth() *oauth1Auth {
+	return &oauth1Auth{
+		creds: docsOAuth1Credentials,
+		nonce: func() string { return "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg" },
+		now:   func() time.Time { return time.Unix(1318622958, 0) },
+	}
+}
+
+func TestOAuth1Signature(t *testing.T) {
+	// https://developer.twitter.com/en/docs/authentication/oauth-1-0a/creating-a-signature
+	params := url.Values{
+		"status":                 {"Hello Ladies + Gentlemen, a signed OAuth request!"},
+		"include_entities":       {"true"},
+		"oauth_consumer_key":     {docsOAuth1Credentials.ConsumerKey},
+		"oauth_nonce":            {"kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg"},
+		"oauth_signature_method": {"HMAC-SHA1"},
+		"oauth_timestamp":        {"1318622958"},
+		"oauth_token":            {docsOAuth1Credentials.AccessToken},
+		"oauth_version":          {"1.0"},
+	}
+
+	signature, err := oauth1Signature(
+		"POST",
+		"https://api.twitter.com/1.1/statuses/update.json",
+		params,
+		docsOAuth1Credentials.ConsumerSecret,
+		docsOAuth1Credentials.AccessTokenSecret,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "hCtSmYh+iHYCEqBWrE7C7hYmtUk=", signature)
+
+	// Query parameters in the url are signed the same way as params
+	signature, err = oauth1Signature(
+		"post",
+		"https://API.twitter.com/1.1/statuses/update.json?include_entities=true",
+		url.Values{
+			"status":                 params["status"],
+			"oauth_consumer_key":     params["oauth_consumer_key"],
+			"oauth_nonce":            params["oauth_nonce"],
+			"oauth_signature_method": params["oauth_signature_method"],
+			"oauth_timestamp":        params["oauth_timestamp"],
+			"oauth_token":            params["oauth_token"],
+			"oauth_version":          params["oauth_version"],
+		},
+		docsOAuth1Credentials.ConsumerSecret,
+		docsOAuth1Credentials.AccessTokenSecret,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "hCtSmYh+iHYCEqBWrE7C7hYmtUk=", signature)
+}
+
+func TestOAuth1AuthorizationHeader(t *testing.T) {
+	header, err := newDocsOAuth1Auth().authorizationHeader(
+		"POST",
+		"https://api.twitter.com/1.1/statuses/update.json",
+		url.Values{
+			"status":           {"Hello Ladies + Gentlemen, a signed OAuth request!"},
+			"include_entities": {"true"},
+		},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, `OAuth oauth_consumer_key="xvz1evFS4wEEPTGEFPHBog", `+
+		`oauth_nonce="kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", `+
+		`oauth_signature="hCtSmYh%2BiHYCEqBWrE7C7hYmtUk%3D", `+
+		`oauth_signature_method="HMAC-SHA1", `+
+		`oauth_timestamp="1318622958", `+
+		`oauth_token="370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", `+
+		`oauth_version="1.0"`, header)
+}
+
+func TestPercentEncode(t *testing.T) {
+	assert.Equal(t, "Ladies%20%2B%20Gentlemen", percentEncode("Ladies + Gentlemen"))
+	assert.Equal(t, "An%20encoded%20string%21", percentEncode("An encoded string!"))
+	assert.Equal(t, "Dogs%2C%20Cats%20%26%20Mice", percentEncode("Dogs, Cats & Mice"))
+	assert.Equal(t, "%E2%98%83", percentEncode("☃"))
+	assert.Equal(t, "abc-._~", percentEncode("abc-._~"))
+}
+
+func TestOAuth1ClientSignsRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		require.True(t, strings.HasPrefix(header, "OAuth "))
+
+		// Verify the signature the same way the API does
+		params := url.Values{}
+		for _, part := range strings.Split(strings.TrimPrefix(header, "OAuth "), ", ") {
+			k, v, _ := strings.Cut(part, "=")
+			v, err := url.PathUnescape(strings.Trim(v, `"`))
+			require.NoError(t, err)
+			params.Set(k, v)
+		}
+		signature := params.Get("oauth_signature")
+		params.Del("oauth_signature")
+
+		expected, err := oauth1Signature(r.Method, "http://"+r.Host+r.URL.String(), params,
+			docsOAuth1Credentials.ConsumerSecret, docsOAuth1Credentials.AccessTokenSecret)
+		require.NoError(t, err)
+		assert.Equal(t, expected, signature)
+
+		w.Write([]byte(`{"data":[{"id":"1","name":"Name","username":"user"}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewOAuth1Client(docsOAuth1Credentials, WithBaseURL(srv.URL+"/2/"))
+
+	resp, err := c.FindUserDetails([]string{"user one", "user+two"})
+	require.NoError(t, err)
+	assert.Len(t, resp.Data, 1)
+}
@@ -0,0 +1,454 @@
+package twitter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// TwitterOAuth2AuthorizeURL is the user facing authorization page for OAuth
+// 2.0 Authorization Code flow.
+const TwitterOAuth2AuthorizeURL = "https://twitter.com/i/oauth2/authorize"
+
+// OAuth2Config describes the OAuth 2.0 app used for user context
+// authentication. See
+// https://developer.twitter.com/en/docs/authentication/oauth-2-0/authorization-code
+type OAuth2Config struct {
+	ClientID string
+	// ClientSecret is only set for confidential clients. Public clients
+	// (native apps, CLIs) authenticate with PKCE only.
+	ClientSecret string
+
+	// RedirectURL must match one of the callback urls configured in the app
+	// settings. For CLI usage this is a local address, for example
+	// http://127.0.0.1:8765/callback
+	RedirectURL string
+
+	// Scopes to request. Include "offline.access" to receive a refresh token.
+	Scopes []string
+
+	// AuthURL defaults to TwitterOAuth2AuthorizeURL
+	AuthURL string
+	// TokenURL defaults to "oauth2/token" of the client base url
+	TokenURL string
+
+	// HTTPClient is used for token requests. When nil a private client with
+	// a 30 seconds timeout is used.
+	HTTPClient *http.Client
+}
+
+func (c OAuth2Config) authURL() string {
+	if c.AuthURL != "" {
+		return c.AuthURL
+	}
+	return TwitterOAuth2AuthorizeURL
+}
+
+func (c OAuth2Config) tokenURL() string {
+	if c.TokenURL != "" {
+		return c.TokenURL
+	}
+	return TwitterV2API + "oauth2/token"
+}
+
+// OAuth2Token is the user access token with optional refresh token.
+type OAuth2Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenType    string    `json:"token_type"`
+	Scope        string    `json:"scope"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// expiryDelta is subtracted from token expiry so that tokens are refreshed
+// slightly before they expire.
+const expiryDelta = time.Minute
+
+// oauth2TokenTimeout is the timeout of token requests without
+// OAuth2Config.HTTPClient
+const oauth2TokenTimeout = time.Second * 30
+
+// Expired returns true when the access token is expired (or about to expire)
+// at given time. Tokens without expiry never expire.
+func (t *OAuth2Token) Expired(now time.Time) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return now.Add(expiryDelta).After(t.Expiry)
+}
+
+// TokenStore persists OAuth 2.0 user tokens between runs. LoadToken returns
+// nil token and nil error when nothing is stored yet.
+type TokenStore interface {
+	LoadToken() (*OAuth2Token, error)
+	SaveToken(*OAuth2Token) error
+}
+
+// MemoryTokenStore keeps the token in memory only.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *OAuth2Token
+}
+
+func (m *MemoryTokenStore) LoadToken() (*OAuth2Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token, nil
+}
+
+func (m *MemoryTokenStore) SaveToken(t *OAuth2Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = t
+	return nil
+}
+
+// FileTokenStore stores the token as json file at Path. The file is written
+// with 0600 permissions since it contains credentials.
+type FileTokenStore struct {
+	Path string
+}
+
+func (f *FileTokenStore) LoadToken() (*OAuth2Token, error) {
+	contents, err := os.ReadFile(f.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	t := &OAuth2Token{}
+	if err := json.Unmarshal(contents, t); err != nil {
+		return nil, fmt.Errorf("parsing token file: %w", err)
+	}
+	return t, nil
+}
+
+func (f *FileTokenStore) SaveToken(t *OAuth2Token) error {
+	contents, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+
+	// Write to temp file first so that token file is never left half written
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// PKCE holds the code verifier and its S256 challenge for a single
+// authorization request. See https://datatracker.ietf.org/doc/html/rfc7636
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE generates a new random code verifier.
+func NewPKCE() (*PKCE, error) {
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKCE{
+		Verifier:  verifier,
+		Challenge: pkceChallenge(verifier),
+	}, nil
+}
+
+// randomURLString returns n random bytes encoded as url safe base64
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the url which user needs to open in the browser to
+// authorize the app.
+func (c OAuth2Config) AuthCodeURL(state string, pkce *PKCE) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", c.ClientID)
+	q.Set("redirect_uri", c.RedirectURL)
+	q.Set("scope", strings.Join(c.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", pkce.Challenge)
+	q.Set("code_challenge_method", "S256")
+
+	return c.authURL() + "?" + q.Encode()
+}
+
+// Exchange exchanges authorization code for access token.
+func (c OAuth2Config) Exchange(code string, pkce *PKCE) (*OAuth2Token, error) {
+	return c.tokenRequest(map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"redirect_uri":  c.RedirectURL,
+		"code_verifier": pkce.Verifier,
+	})
+}
+
+// Refresh obtains a new access token with refreshToken.
+func (c OAuth2Config) Refresh(refreshToken string) (*OAuth2Token, error) {
+	return c.tokenRequest(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	})
+}
+
+// oauth2TokenResponse is the response of oauth2/token endpoint
+type oauth2TokenResponse struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (c OAuth2Config) tokenRequest(form map[string]string) (*OAuth2Token, error) {
+	// resty sets the transport of the given client, http.DefaultClient is
+	// shared by the whole process and must not be passed
+	r := resty.New().SetTimeout(oauth2TokenTimeout)
+	if c.HTTPClient != nil {
+		r = resty.NewWithClient(c.HTTPClient)
+	}
+
+	req := r.R().SetFormData(form)
+	// Confidential clients authenticate with basic auth, public clients
+	// must send client_id in the body.
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	} else {
+		req.SetFormData(map[string]string{"client_id": c.ClientID})
+	}
+
+	resp, err := req.Post(c.tokenURL())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 {
+		return nil, newErrAPI(resp.StatusCode(), resp.Body())
+	}
+
+	tr := &oauth2TokenResponse{}
+	if err := json.Unmarshal(resp.Body(), tr); err != nil {
+		return nil, fmt.Errorf("parsing token response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("token response does not include access_token")
+	}
+
+	t := &OAuth2Token{
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		TokenType:    tr.TokenType,
+		Scope:        tr.Scope,
+	}
+	if tr.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	return t, nil
+}
+
+// AuthorizeWithLocalRedirect runs the Authorization Code with PKCE flow for
+// CLI usage. It starts a http listener on RedirectURL host, passes the
+// authorization url to openURL (which should print it or open the browser)
+// and waits until user authorizes the app or ctx is done. Obtained token is
+// saved to store.
+func AuthorizeWithLocalRedirect(ctx context.Context, cfg OAuth2Config, store TokenStore, openURL func(string) error) (*OAuth2Token, error) {
+	redirect, err := url.Parse(cfg.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redirect url: %w", err)
+	}
+
+	pkce, err := NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomURLString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return nil, fmt.Errorf("starting redirect listener: %w", err)
+	}
+
+	type callbackResult struct {
+		code string
+		err  error
+	}
+	results := make(chan callbackResult, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirect.Path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		res := callbackResult{code: q.Get("code")}
+		switch {
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("authorization failed: %s", q.Get("error"))
+		case q.Get("state") != state:
+			res.err = fmt.Errorf("authorization failed: state mismatch")
+		case res.code == "":
+			res.err = fmt.Errorf("authorization failed: missing code")
+		}
+
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			w.Write([]byte("Authorization complete, you can close this window."))
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if err := openURL(cfg.AuthCodeURL(state, pkce)); err != nil {
+		return nil, err
+	}
+
+	var res callbackResult
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res = <-results:
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	token, err := cfg.Exchange(res.code, pkce)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging authorization code: %w", err)
+	}
+
+	if err := store.SaveToken(token); err != nil {
+		return nil, fmt.Errorf("saving token: %w", err)
+	}
+
+	return token, nil
+}
+
+// NewOAuth2UserClient creates a client authenticating in user context with
+// the token from store. Expired access tokens are refreshed automatically and
+// the refreshed token is saved back to store. Use AuthorizeWithLocalRedirect
+// to obtain the initial token.
+func NewOAuth2UserClient(cfg OAuth2Config, store TokenStore, options ...ClientOption) (*twitterHTTPClient, error) {
+	token, err := store.LoadToken()
+	if err != nil {
+		return nil, fmt.Errorf("loading token: %w", err)
+	}
+	if token == nil {
+		return nil, fmt.Errorf("token store is empty, authorize the app first")
+	}
+
+	auth := &oauth2UserAuth{
+		cfg:   cfg,
+		store: store,
+		token: token,
+		now:   time.Now,
+	}
+	t := newTwitterHTTPClient(auth, options...)
+
+	// Token requests go to the same API host and through the same http
+	// client as the rest of the requests unless configured otherwise.
+	if auth.cfg.TokenURL == "" {
+		auth.cfg.TokenURL = t.baseURL + "oauth2/token"
+	}
+	if auth.cfg.HTTPClient == nil {
+		auth.cfg.HTTPClient = t.r.GetClient()
+	}
+
+	return t, nil
+}
+
+// oauth2UserAuth authenticates requests with OAuth 2.0 user access token
+type oauth2UserAuth struct {
+	cfg   OAuth2Config
+	store TokenStore
+
+	mu    sync.Mutex
+	token *OAuth2Token
+
+	now func() time.Time
+}
+
+func (o *oauth2UserAuth) authenticate(req *resty.Request, method, endpoint string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token.Expired(o.now()) {
+		if err := o.refreshLocked(); err != nil {
+			return err
+		}
+	}
+
+	req.SetAuthToken(o.token.AccessToken)
+	return nil
+}
+
+func (o *oauth2UserAuth) refreshToken() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.refreshLocked()
+}
+
+func (o *oauth2UserAuth) refreshLocked() error {
+	if o.token.RefreshToken == "" {
+		return fmt.Errorf("access token expired and no refresh token is available")
+	}
+
+	token, err := o.cfg.Refresh(o.token.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("refreshing access token: %w", err)
+	}
+	// Refresh token is not always rotated
+	if token.RefreshToken == "" {
+		token.RefreshToken = o.token.RefreshToken
+	}
+	o.token = token
+
+	if err := o.store.SaveToken(token); err != nil {
+		slog.Error("saving refreshed token failed", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
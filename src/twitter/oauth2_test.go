@@ -0,0 +1,158 @@
+package twitter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// Example from RFC 7636 Appendix B
+	assert.Equal(t,
+		"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		pkceChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"),
+	)
+
+	p, err := NewPKCE()
+	require.NoError(t, err)
+	assert.Len(t, p.Verifier, 43)
+	assert.Equal(t, pkceChallenge(p.Verifier), p.Challenge)
+}
+
+// newOAuth2TestServer serves oauth2/token and users/by endpoints. Only
+// "fresh-token" access token is accepted by users/by.
+func newOAuth2TestServer(t *testing.T, tokenRequests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2/oauth2/token":
+			tokenRequests.Add(1)
+			require.NoError(t, r.ParseForm())
+
+			switch r.PostForm.Get("grant_type") {
+			case "refresh_token":
+				assert.Equal(t, "refresh-1", r.PostForm.Get("refresh_token"))
+			case "authorization_code":
+				assert.Equal(t, "auth-code", r.PostForm.Get("code"))
+				assert.NotEmpty(t, r.PostForm.Get("code_verifier"))
+			default:
+				t.Errorf("unexpected grant_type %s", r.PostForm.Get("grant_type"))
+			}
+			assert.Equal(t, "client-id", r.PostForm.Get("client_id"))
+
+			w.Write([]byte(`{"token_type":"bearer","expires_in":7200,"access_token":"fresh-token","scope":"tweet.read users.read offline.access","refresh_token":"refresh-2"}`))
+		case "/2/users/by":
+			if r.Header.Get("Authorization") != "Bearer fresh-token" {
+				w.WriteHeader(401)
+				w.Write([]byte(`{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`))
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"1","name":"Name","username":"user"}]}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+}
+
+func TestOAuth2UserClientRefresh(t *testing.T) {
+	tests := []struct {
+		name  string
+		token *OAuth2Token
+	}{
+		{
+			name: "refreshes expired token before request",
+			token: &OAuth2Token{
+				AccessToken:  "old-token",
+				RefreshToken: "refresh-1",
+				Expiry:       time.Now().Add(-time.Hour),
+			},
+		},
+		{
+			name: "refreshes revoked token on 401",
+			token: &OAuth2Token{
+				AccessToken:  "old-token",
+				RefreshToken: "refresh-1",
+				Expiry:       time.Now().Add(time.Hour),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenRequests := atomic.Int32{}
+			srv := newOAuth2TestServer(t, &tokenRequests)
+			defer srv.Close()
+
+			store := &MemoryTokenStore{}
+			require.NoError(t, store.SaveToken(tt.token))
+
+			c, err := NewOAuth2UserClient(OAuth2Config{ClientID: "client-id"}, store,
+				WithBaseURL(srv.URL+"/2/"),
+				WithRetryPolicy(NoRetryPolicy()),
+			)
+			require.NoError(t, err)
+
+			resp, err := c.FindUserDetails([]string{"user"})
+			require.NoError(t, err)
+			assert.Len(t, resp.Data, 1)
+			assert.Equal(t, int32(1), tokenRequests.Load())
+
+			saved, err := store.LoadToken()
+			require.NoError(t, err)
+			assert.Equal(t, "fresh-token", saved.AccessToken)
+			assert.Equal(t, "refresh-2", saved.RefreshToken)
+		})
+	}
+}
+
+func TestAuthorizeWithLocalRedirect(t *testing.T) {
+	tokenRequests := atomic.Int32{}
+	srv := newOAuth2TestServer(t, &tokenRequests)
+	defer srv.Close()
+
+	// Find a free port for the redirect listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURL := "http://" + ln.Addr().String() + "/callback"
+	ln.Close()
+
+	cfg := OAuth2Config{
+		ClientID:    "client-id",
+		RedirectURL: redirectURL,
+		Scopes:      []string{"tweet.read", "users.read", "offline.access"},
+		TokenURL:    srv.URL + "/2/oauth2/token",
+	}
+	store := &MemoryTokenStore{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	token, err := AuthorizeWithLocalRedirect(ctx, cfg, store, func(authURL string) error {
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		q := u.Query()
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		assert.Equal(t, "tweet.read users.read offline.access", q.Get("scope"))
+		assert.Equal(t, redirectURL, q.Get("redirect_uri"))
+
+		// Simulate the browser redirect after user authorized the app
+		go http.Get(redirectURL + "?code=auth-code&state=" + url.QueryEscape(q.Get("state")))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "fresh-token", token.AccessToken)
+	// Token request without HTTPClient does not modify the shared default
+	// client
+	assert.Nil(t, http.DefaultClient.Transport)
+
+	saved, err := store.LoadToken()
+	require.NoError(t, err)
+	assert.Equal(t, token, saved)
+}
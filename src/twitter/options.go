@@ -1,6 +1,10 @@
 package twitter
 
-import "github.com/go-resty/resty/v2"
+import (
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
 
 // ApiRequestOption is provided for modifying the requests
 type ApiRequestOption interface {
@@ -32,3 +36,31 @@ func OptApplyMaxResults(maxResult string) ApiRequestOption {
 		Value: maxResult,
 	}
 }
+
+// OptMergeQueryParam adds comma separated values to a query parameter. Values
+// already present in the request (for example client defaults) are kept, so
+// unlike OptApplyQueryParam it never overwrites other options.
+type OptMergeQueryParam struct {
+	Key    string
+	Values []string
+}
+
+func (o *OptMergeQueryParam) Apply(req *resty.Request) {
+	req.SetQueryParam(o.Key, mergeCommaSeparated(req.QueryParam.Get(o.Key), o.Values))
+}
+
+// mergeCommaSeparated appends values missing from the comma separated list
+// current.
+func mergeCommaSeparated(current string, values []string) string {
+	merged := []string{}
+	seen := map[string]bool{}
+	for _, v := range append(strings.Split(current, ","), values...) {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		merged = append(merged, v)
+	}
+	return strings.Join(merged, ",")
+}
@@ -0,0 +1,283 @@
+package twitter
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// LimiterSet holds a rate limiter for each endpoint of a single credential.
+// Endpoints without a limiter are not limited.
+type LimiterSet map[Endpoint]ApiRateLimiter
+
+// NewProLimiterSet creates limiters matching the PRO API plan app limits.
+func NewProLimiterSet() LimiterSet {
+	return LimiterSet{
+		EndpointUserTweets:      NewRateLimiter(75, time.Minute*15),
+		EndpointUserLikedTweets: NewRateLimiter(75, time.Minute*15),
+		EndpointTweetLikers:     NewRateLimiter(25, time.Minute*15),
+		EndpointTweetRetweeters: NewRateLimiter(5, time.Minute*15),
+		EndpointUserLookup:      NewRateLimiter(300, time.Minute*15),
+	}
+}
+
+// PooledCredential is a single credential of CredentialPool.
+type PooledCredential struct {
+	// Name identifies the credential in logs and stats. Never put the secret
+	// itself here.
+	Name string
+
+	// Client authenticated with this credential
+	Client Client
+
+	// Limiters of this credential
+	Limiters LimiterSet
+}
+
+// CredentialStats are usage stats of a single pooled credential.
+type CredentialStats struct {
+	Name string
+
+	// Number of requests sent with this credential
+	Requests uint
+	// Number of requests rejected with HTTP 429
+	RateLimited uint
+	// Number of requests failed with any other error
+	Errors uint
+
+	// Remaining requests in the current window per endpoint. Only reported
+	// for limiters which expose the remaining budget (TwitterRateLimiter).
+	Remaining map[Endpoint]int
+}
+
+// remainingReporter is implemented by limiters which know their remaining
+// budget, see TwitterRateLimiter.Remaining
+type remainingReporter interface {
+	Remaining() int
+}
+
+type pooledCredential struct {
+	PooledCredential
+	stats CredentialStats
+}
+
+func (c *pooledCredential) limiter(endpoint Endpoint) ApiRateLimiter {
+	return c.Limiters[endpoint]
+}
+
+// remaining returns the remaining budget for endpoint. Unlimited endpoints
+// and limiters which do not report the budget are treated as having a full
+// budget, Allow is still consulted before sending a request.
+func (c *pooledCredential) remaining(endpoint Endpoint) int {
+	l := c.limiter(endpoint)
+	if l == nil {
+		return math.MaxInt
+	}
+	if rr, ok := l.(remainingReporter); ok {
+		return rr.Remaining()
+	}
+	if l.WaitTime() > 0 {
+		return 0
+	}
+	return math.MaxInt
+}
+
+// CredentialPool is a Client which spreads the requests across multiple
+// credentials. Every request is routed to the credential with the most
+// remaining budget for the endpoint. When a credential gets rate limited by
+// the API, the request is transparently retried with another credential.
+// ErrRateLimited is returned only when all credentials are exhausted.
+//
+// Note that Analyzer limiters apply on top of the pool limiters, configure
+// them to the combined budget of all credentials.
+type CredentialPool struct {
+	Logger *slog.Logger
+
+	mu    sync.Mutex
+	creds []*pooledCredential
+}
+
+var _ Client = (*CredentialPool)(nil)
+
+// NewCredentialPool creates a pool of given credentials.
+func NewCredentialPool(creds ...PooledCredential) *CredentialPool {
+	p := &CredentialPool{
+		Logger: slog.Default(),
+	}
+	for _, c := range creds {
+		p.creds = append(p.creds, &pooledCredential{
+			PooledCredential: c,
+			stats:            CredentialStats{Name: c.Name},
+		})
+	}
+	return p
+}
+
+// Size returns the number of pooled credentials.
+func (p *CredentialPool) Size() int {
+	return len(p.creds)
+}
+
+// StreamClient returns the client of the first pooled credential supporting
+// the filtered stream. Stream rules and connections belong to the app of a
+// single credential, they are not rotated.
+func (p *CredentialPool) StreamClient() (StreamClient, bool) {
+	for _, c := range p.creds {
+		if sc, ok := c.Client.(StreamClient); ok {
+			return sc, true
+		}
+	}
+	return nil, false
+}
+
+// Stats returns usage stats of each credential in the order they were added.
+func (p *CredentialPool) Stats() []CredentialStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := make([]CredentialStats, len(p.creds))
+	for i, c := range p.creds {
+		ret[i] = c.stats
+		ret[i].Remaining = map[Endpoint]int{}
+		for endpoint, l := range c.Limiters {
+			if rr, ok := l.(remainingReporter); ok {
+				ret[i].Remaining[endpoint] = rr.Remaining()
+			}
+		}
+	}
+	return ret
+}
+
+// acquire reserves a request for endpoint on the credential with the most
+// remaining budget, skipping the already tried credentials. Returns nil when
+// no credential can run the request now.
+func (p *CredentialPool) acquire(endpoint Endpoint, tried map[*pooledCredential]bool) *pooledCredential {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		var best *pooledCredential
+		bestRemaining := 0
+		for _, c := range p.creds {
+			if tried[c] {
+				continue
+			}
+			if r := c.remaining(endpoint); r > bestRemaining {
+				best, bestRemaining = c, r
+			}
+		}
+		if best == nil {
+			return nil
+		}
+
+		if l := best.limiter(endpoint); l != nil && !l.Allow() {
+			tried[best] = true
+			continue
+		}
+
+		best.stats.Requests++
+		return best
+	}
+}
+
+// earliestReset returns the unix timestamp when the first credential becomes
+// available for endpoint again.
+func (p *CredentialPool) earliestReset(endpoint Endpoint) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var wait time.Duration = -1
+	for _, c := range p.creds {
+		l := c.limiter(endpoint)
+		if l == nil {
+			continue
+		}
+		if w := l.WaitTime(); wait < 0 || w < wait {
+			wait = w
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return time.Now().Add(wait).Unix()
+}
+
+// poolDo runs call with the pooled credentials until it succeeds, fails with
+// a non rate limit error or all credentials are exhausted.
+func poolDo[T any](p *CredentialPool, endpoint Endpoint, call func(Client) (T, error)) (T, error) {
+	var zero T
+	if len(p.creds) == 0 {
+		return zero, fmt.Errorf("credential pool is empty")
+	}
+
+	tried := map[*pooledCredential]bool{}
+	for {
+		c := p.acquire(endpoint, tried)
+		if c == nil {
+			return zero, &ErrRateLimited{ResetTimestamp: p.earliestReset(endpoint)}
+		}
+		tried[c] = true
+
+		ret, err := call(c.Client)
+		if err == nil {
+			return ret, nil
+		}
+
+		erl := &ErrRateLimited{}
+		if !errors.As(err, &erl) {
+			p.mu.Lock()
+			c.stats.Errors++
+			p.mu.Unlock()
+			return zero, err
+		}
+
+		p.mu.Lock()
+		c.stats.RateLimited++
+		if l := c.limiter(endpoint); l != nil {
+			l.MarkLimited()
+			if erl.ResetTimestamp > 0 {
+				l.SetAvailableTime(erl.ResetTimestamp)
+			}
+		}
+		p.mu.Unlock()
+
+		p.Logger.Warn("credential rate limited, retrying with another credential",
+			slog.String("credential", c.Name),
+			slog.String("endpoint", string(endpoint)),
+			slog.Time("next_reset_from_api", time.Unix(erl.ResetTimestamp, 0)),
+		)
+	}
+}
+
+func (p *CredentialPool) FetchUserTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	return poolDo(p, EndpointUserTweets, func(c Client) (*TweetsResponse, error) {
+		return c.FetchUserTweets(userId, options...)
+	})
+}
+
+func (p *CredentialPool) FetchUserLikedTweets(userId string, options ...ApiRequestOption) (*TweetsResponse, error) {
+	return poolDo(p, EndpointUserLikedTweets, func(c Client) (*TweetsResponse, error) {
+		return c.FetchUserLikedTweets(userId, options...)
+	})
+}
+
+func (p *CredentialPool) FetchTweetLikers(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
+	return poolDo(p, EndpointTweetLikers, func(c Client) (*UserInteractorsResponse, error) {
+		return c.FetchTweetLikers(tweetId, options...)
+	})
+}
+
+func (p *CredentialPool) FetchTweetRetweeters(tweetId string, options ...ApiRequestOption) (*UserInteractorsResponse, error) {
+	return poolDo(p, EndpointTweetRetweeters, func(c Client) (*UserInteractorsResponse, error) {
+		return c.FetchTweetRetweeters(tweetId, options...)
+	})
+}
+
+func (p *CredentialPool) FindUserDetails(userNames []string, options ...ApiRequestOption) (*UserLookupResponse, error) {
+	return poolDo(p, EndpointUserLookup, func(c Client) (*UserLookupResponse, error) {
+		return c.FindUserDetails(userNames, options...)
+	})
+}
@@ -0,0 +1,110 @@
+package twitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubClient is a Client which returns the same user lookup result for every
+// call and records number of calls.
+type stubClient struct {
+	Client
+	calls int
+	err   error
+}
+
+func (s *stubClient) FindUserDetails(userNames []string, options ...ApiRequestOption) (*UserLookupResponse, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &UserLookupResponse{Data: []UserDetail{{Id: "1"}}}, nil
+}
+
+func TestCredentialPool(t *testing.T) {
+	t.Run("routes to credential with most remaining budget", func(t *testing.T) {
+		a, b := &stubClient{}, &stubClient{}
+		p := NewCredentialPool(
+			PooledCredential{Name: "a", Client: a, Limiters: LimiterSet{EndpointUserLookup: NewRateLimiter(2, time.Minute)}},
+			PooledCredential{Name: "b", Client: b, Limiters: LimiterSet{EndpointUserLookup: NewRateLimiter(4, time.Minute)}},
+		)
+
+		for i := 0; i < 6; i++ {
+			_, err := p.FindUserDetails([]string{"user"})
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, a.calls)
+		assert.Equal(t, 4, b.calls)
+
+		// Both credentials are exhausted
+		_, err := p.FindUserDetails([]string{"user"})
+		erl := &ErrRateLimited{}
+		require.ErrorAs(t, err, &erl)
+		assert.Greater(t, erl.ResetTimestamp, int64(0))
+
+		stats := p.Stats()
+		assert.Equal(t, []CredentialStats{
+			{Name: "a", Requests: 2, Remaining: map[Endpoint]int{EndpointUserLookup: 0}},
+			{Name: "b", Requests: 4, Remaining: map[Endpoint]int{EndpointUserLookup: 0}},
+		}, stats)
+	})
+
+	t.Run("retries rate limited request on another credential", func(t *testing.T) {
+		reset := time.Now().Add(time.Minute * 10).Unix()
+		a := &stubClient{err: &ErrRateLimited{ResetTimestamp: reset}}
+		b := &stubClient{}
+		limiterA := NewRateLimiter(10, time.Minute*15)
+		p := NewCredentialPool(
+			PooledCredential{Name: "a", Client: a, Limiters: LimiterSet{EndpointUserLookup: limiterA}},
+			PooledCredential{Name: "b", Client: b, Limiters: LimiterSet{EndpointUserLookup: NewRateLimiter(5, time.Minute*15)}},
+		)
+
+		resp, err := p.FindUserDetails([]string{"user"})
+		require.NoError(t, err)
+		assert.Len(t, resp.Data, 1)
+		assert.Equal(t, 1, a.calls)
+		assert.Equal(t, 1, b.calls)
+
+		// Limited credential is not used until reset
+		assert.Equal(t, 0, limiterA.Remaining())
+		_, err = p.FindUserDetails([]string{"user"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, a.calls)
+		assert.Equal(t, 2, b.calls)
+
+		stats := p.Stats()
+		assert.Equal(t, uint(1), stats[0].RateLimited)
+		assert.Equal(t, uint(2), stats[1].Requests)
+	})
+
+	t.Run("returns other errors without retrying", func(t *testing.T) {
+		a := &stubClient{err: newErrAPI(401, nil)}
+		b := &stubClient{}
+		p := NewCredentialPool(
+			PooledCredential{Name: "a", Client: a, Limiters: LimiterSet{EndpointUserLookup: NewRateLimiter(10, time.Minute)}},
+			PooledCredential{Name: "b", Client: b, Limiters: LimiterSet{EndpointUserLookup: NewRateLimiter(5, time.Minute)}},
+		)
+
+		_, err := p.FindUserDetails([]string{"user"})
+		assert.True(t, IsUnauthorized(err))
+		assert.Equal(t, 0, b.calls)
+		assert.Equal(t, uint(1), p.Stats()[0].Errors)
+	})
+}
+
+func TestCredentialPoolStreamClient(t *testing.T) {
+	bearer := NewAuthBearerClient("bearer")
+	p := NewCredentialPool(
+		PooledCredential{Name: "stub", Client: &stubClient{}},
+		PooledCredential{Name: "bearer", Client: bearer},
+	)
+	sc, ok := p.StreamClient()
+	require.True(t, ok)
+	assert.Same(t, bearer, sc)
+
+	_, ok = NewCredentialPool(PooledCredential{Name: "stub", Client: &stubClient{}}).StreamClient()
+	assert.False(t, ok)
+}
@@ -12,27 +12,159 @@ type TweetsResponse struct {
 	// in Data tweets.
 	Includes TweetIncludes `json:"includes"`
 
+	// Errors are partial errors returned alongside HTTP 200 responses, for
+	// example deleted or protected referenced tweets.
+	Errors []ProblemDetail `json:"errors"`
+
 	// Raw is the raw json response from the API
 	Raw json.RawMessage `json:"-"`
 }
 
 // FindReferencedTweet finds the referenced tweet by id. Returns nil if not
-// found.
+// found. The returned tweet points into Includes.Tweets.
 func (u *TweetsResponse) FindReferencedTweet(referencedTweetId string) *Tweet {
-	for _, tweet := range u.Includes.Tweets {
-		tweet := tweet
-		if tweet.TweetId == referencedTweetId {
-			return &tweet
+	return u.Includes.tweet(referencedTweetId)
+}
+
+// FindResourceError finds the partial error for given resource id (tweet or
+// user id). Returns nil if not found.
+func (u *TweetsResponse) FindResourceError(resourceId string) *ProblemDetail {
+	return findResourceError(u.Errors, resourceId)
+}
+
+func findResourceError(errs []ProblemDetail, resourceId string) *ProblemDetail {
+	for i := range errs {
+		if errs[i].ResourceId == resourceId || errs[i].Value == resourceId {
+			return &errs[i]
 		}
 	}
-
 	return nil
 }
 
-// Tweets includes object
+// FindIncludedUser finds the expanded user (author, replied to or mentioned
+// user) by id. Returns nil if not found.
+func (u *TweetsResponse) FindIncludedUser(userId string) *UserDetail {
+	return u.Includes.user(userId)
+}
+
+// FindMedia finds the expanded media by media key. Returns nil if not found.
+func (u *TweetsResponse) FindMedia(mediaKey string) *Media {
+	return u.Includes.media(mediaKey)
+}
+
+// FindPoll finds the expanded poll by id. Returns nil if not found.
+func (u *TweetsResponse) FindPoll(pollId string) *Poll {
+	return u.Includes.poll(pollId)
+}
+
+// FindPlace finds the expanded place by id. Returns nil if not found.
+func (u *TweetsResponse) FindPlace(placeId string) *Place {
+	return u.Includes.place(placeId)
+}
+
+// Tweets includes object. Lookups build an index on first use, responses are
+// not safe for concurrent lookups.
 type TweetIncludes struct {
 	// Included referenced tweets
 	Tweets []Tweet `json:"tweets"`
+
+	// Included users (authors, replied to users) of expanded tweets
+	Users []UserDetail `json:"users"`
+
+	// Included attachments of expanded tweets
+	Media  []Media `json:"media"`
+	Polls  []Poll  `json:"polls"`
+	Places []Place `json:"places"`
+
+	tweetsIndex map[string]int
+	usersIndex  map[string]int
+	mediaIndex  map[string]int
+	pollsIndex  map[string]int
+	placesIndex map[string]int
+}
+
+// buildIndex maps keys of items to their position in items. The first item
+// wins for duplicate keys.
+func buildIndex[T any](items []T, key func(*T) string) map[string]int {
+	index := make(map[string]int, len(items))
+	for i := range items {
+		k := key(&items[i])
+		if _, ok := index[k]; !ok {
+			index[k] = i
+		}
+	}
+	return index
+}
+
+// lookup finds the item by key, building the index when needed
+func lookup[T any](items []T, index *map[string]int, key func(*T) string, k string) *T {
+	if *index == nil {
+		*index = buildIndex(items, key)
+	}
+	if i, ok := (*index)[k]; ok {
+		return &items[i]
+	}
+	return nil
+}
+
+func (i *TweetIncludes) tweet(id string) *Tweet {
+	return lookup(i.Tweets, &i.tweetsIndex, func(t *Tweet) string { return t.TweetId }, id)
+}
+
+func (i *TweetIncludes) user(id string) *UserDetail {
+	return lookup(i.Users, &i.usersIndex, func(u *UserDetail) string { return u.Id }, id)
+}
+
+func (i *TweetIncludes) media(key string) *Media {
+	return lookup(i.Media, &i.mediaIndex, func(m *Media) string { return m.MediaKey }, key)
+}
+
+func (i *TweetIncludes) poll(id string) *Poll {
+	return lookup(i.Polls, &i.pollsIndex, func(p *Poll) string { return p.Id }, id)
+}
+
+func (i *TweetIncludes) place(id string) *Place {
+	return lookup(i.Places, &i.placesIndex, func(p *Place) string { return p.Id }, id)
+}
+
+// See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/media
+type Media struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"`
+	URL             string `json:"url"`
+	PreviewImageURL string `json:"preview_image_url"`
+	DurationMs      uint   `json:"duration_ms"`
+	Height          uint   `json:"height"`
+	Width           uint   `json:"width"`
+	AltText         string `json:"alt_text"`
+}
+
+// See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/poll
+type Poll struct {
+	Id              string       `json:"id"`
+	Options         []PollOption `json:"options"`
+	DurationMinutes uint         `json:"duration_minutes"`
+	EndDatetime     string       `json:"end_datetime"`
+	VotingStatus    string       `json:"voting_status"`
+}
+
+type PollOption struct {
+	Position uint   `json:"position"`
+	Label    string `json:"label"`
+	Votes    uint   `json:"votes"`
+}
+
+// See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/place
+type Place struct {
+	Id          string `json:"id"`
+	FullName    string `json:"full_name"`
+	Name        string `json:"name"`
+	Country     string `json:"country"`
+	CountryCode string `json:"country_code"`
+	PlaceType   string `json:"place_type"`
 }
 
 type Meta struct {
@@ -62,6 +194,75 @@ type Tweet struct {
 	// Referenced tweets refs. UserTweetsResponse.Includes.Tweets will include
 	// full details of referenced tweets (linked via Id)
 	ReferencedTweets []ReferencedTweetMeta `json:"referenced_tweets"`
+
+	// Engagement counts, nil when public_metrics tweet field was not
+	// requested
+	PublicMetrics *TweetPublicMetrics `json:"public_metrics,omitempty"`
+
+	// Attached media and polls, resolve them with FindMedia and FindPoll
+	Attachments *TweetAttachments `json:"attachments,omitempty"`
+
+	// Tagged place, resolve it with FindPlace
+	Geo *TweetGeo `json:"geo,omitempty"`
+
+	// Hashtags and mentions parsed from the text, nil when entities tweet
+	// field was not requested
+	Entities *TweetEntities `json:"entities,omitempty"`
+
+	// Start and end offset of the text written by the author, replies start
+	// after the leading @handles of the replied to users. Nil when
+	// display_text_range tweet field was not requested
+	DisplayTextRange []int `json:"display_text_range,omitempty"`
+}
+
+type TweetAttachments struct {
+	MediaKeys []string `json:"media_keys"`
+	PollIds   []string `json:"poll_ids"`
+}
+
+type TweetGeo struct {
+	PlaceId string `json:"place_id"`
+}
+
+// See
+// https://developer.twitter.com/en/docs/twitter-api/data-dictionary/object-model/tweet
+type TweetEntities struct {
+	Hashtags []HashtagEntity `json:"hashtags,omitempty"`
+	Mentions []MentionEntity `json:"mentions,omitempty"`
+}
+
+type HashtagEntity struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Tag   string `json:"tag"`
+}
+
+type MentionEntity struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Username string `json:"username"`
+	// Id is set when entities.mentions.username expansion was requested
+	Id string `json:"id,omitempty"`
+}
+
+// See
+// https://developer.twitter.com/en/docs/twitter-api/metrics
+type TweetPublicMetrics struct {
+	RetweetCount    uint `json:"retweet_count"`
+	ReplyCount      uint `json:"reply_count"`
+	LikeCount       uint `json:"like_count"`
+	QuoteCount      uint `json:"quote_count"`
+	BookmarkCount   uint `json:"bookmark_count"`
+	ImpressionCount uint `json:"impression_count"`
+}
+
+func (m *TweetPublicMetrics) add(o *TweetPublicMetrics) {
+	m.RetweetCount += o.RetweetCount
+	m.ReplyCount += o.ReplyCount
+	m.LikeCount += o.LikeCount
+	m.QuoteCount += o.QuoteCount
+	m.BookmarkCount += o.BookmarkCount
+	m.ImpressionCount += o.ImpressionCount
 }
 
 type ReferencedTweetType string
@@ -92,6 +293,9 @@ type UserInteractorsResponse struct {
 	// Only for next_token
 	Meta Meta `json:"meta"`
 
+	// Partial errors, see TweetsResponse.Errors
+	Errors []ProblemDetail `json:"errors"`
+
 	// Raw is the raw json response from the API
 	Raw json.RawMessage `json:"-"`
 }
@@ -101,6 +305,10 @@ type UserInteractorsResponse struct {
 type UserLookupResponse struct {
 	Data []UserDetail `json:"data"`
 
+	// Partial errors for usernames which could not be resolved (suspended or
+	// non existing users).
+	Errors []ProblemDetail `json:"errors"`
+
 	Raw json.RawMessage `json:"-"`
 }
 
@@ -108,4 +316,15 @@ type UserDetail struct {
 	Id       string `json:"id"`
 	Name     string `json:"name"`
 	Username string `json:"username"`
+
+	// Follower and activity counts, nil when public_metrics user field was
+	// not requested
+	PublicMetrics *UserPublicMetrics `json:"public_metrics,omitempty"`
+}
+
+type UserPublicMetrics struct {
+	FollowersCount uint `json:"followers_count"`
+	FollowingCount uint `json:"following_count"`
+	TweetCount     uint `json:"tweet_count"`
+	ListedCount    uint `json:"listed_count"`
 }
@@ -0,0 +1,76 @@
+package twitter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTweetsResponseIncludesLookups(t *testing.T) {
+	body := []byte(`{
+		"data": [{
+			"id": "10",
+			"author_id": "1",
+			"text": "poll with a photo",
+			"attachments": {"media_keys": ["3_100"], "poll_ids": ["500"]},
+			"geo": {"place_id": "01a9a39529b27f36"}
+		}],
+		"includes": {
+			"users": [
+				{"id": "1", "name": "First", "username": "first"},
+				{"id": "2", "name": "Second", "username": "second"}
+			],
+			"media": [{"media_key": "3_100", "type": "photo", "url": "https://pbs.twimg.com/media/x.jpg", "width": 800, "height": 600}],
+			"polls": [{"id": "500", "voting_status": "open", "options": [{"position": 1, "label": "yes", "votes": 3}]}],
+			"places": [{"id": "01a9a39529b27f36", "full_name": "Manhattan, NY", "country_code": "US", "place_type": "city"}]
+		}
+	}`)
+
+	resp := &TweetsResponse{}
+	require.NoError(t, json.Unmarshal(body, resp))
+	tweet := resp.Data[0]
+
+	author := resp.FindIncludedUser(tweet.AuthorUserId)
+	require.NotNil(t, author)
+	assert.Equal(t, "first", author.Username)
+	assert.Equal(t, "second", resp.FindIncludedUser("2").Username)
+	assert.Nil(t, resp.FindIncludedUser("3"))
+
+	media := resp.FindMedia(tweet.Attachments.MediaKeys[0])
+	require.NotNil(t, media)
+	assert.Equal(t, Media{MediaKey: "3_100", Type: "photo", URL: "https://pbs.twimg.com/media/x.jpg", Width: 800, Height: 600}, *media)
+	assert.Nil(t, resp.FindMedia("3_200"))
+
+	poll := resp.FindPoll(tweet.Attachments.PollIds[0])
+	require.NotNil(t, poll)
+	assert.Equal(t, []PollOption{{Position: 1, Label: "yes", Votes: 3}}, poll.Options)
+	assert.Nil(t, resp.FindPoll("501"))
+
+	place := resp.FindPlace(tweet.Geo.PlaceId)
+	require.NotNil(t, place)
+	assert.Equal(t, "Manhattan, NY", place.FullName)
+	assert.Nil(t, resp.FindPlace("x"))
+
+	// Lookups return the included objects, not copies
+	author.Name = "Renamed"
+	assert.Equal(t, "Renamed", resp.Includes.Users[0].Name)
+}
+
+func TestFindReferencedTweet(t *testing.T) {
+	resp := &TweetsResponse{
+		Includes: TweetIncludes{
+			Tweets: []Tweet{
+				{TweetId: "1", AuthorUserId: "a"},
+				{TweetId: "2", AuthorUserId: "b"},
+				// Duplicates resolve to the first included tweet
+				{TweetId: "1", AuthorUserId: "c"},
+			},
+		},
+	}
+
+	assert.Same(t, &resp.Includes.Tweets[0], resp.FindReferencedTweet("1"))
+	assert.Same(t, &resp.Includes.Tweets[1], resp.FindReferencedTweet("2"))
+	assert.Nil(t, resp.FindReferencedTweet("3"))
+}
@@ -0,0 +1,144 @@
+package twitter
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how transient API failures are retried by the http
+// client. Rate limited (HTTP 429) responses are not retried by default, these
+// are surfaced as ErrRateLimited so that callers can respect the rate limit
+// windows.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first
+	// request. Values less than 2 disable retrying.
+	MaxAttempts int
+
+	// InitialBackoff is the wait time before the first retry. Each subsequent
+	// retry multiplies the previous wait time by Multiplier.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait time between two attempts. Retry-After values
+	// returned by the API are capped as well.
+	MaxBackoff time.Duration
+
+	// Multiplier for exponential backoff. Defaults to 2 when not set.
+	Multiplier float64
+
+	// Jitter is a fraction (0-1) of the computed backoff which is randomly
+	// added or subtracted from the wait time.
+	Jitter float64
+
+	// RetryableStatuses is a set of HTTP status codes which are considered
+	// transient.
+	RetryableStatuses map[int]bool
+
+	// RetryNetworkErrors enables retrying when request fails without a
+	// response (connection reset, timeout, etc.).
+	RetryNetworkErrors bool
+
+	// RetryNonIdempotent enables retrying POST requests as well. These are
+	// not retried by default, a request which timed out or failed with a
+	// server error might still have been applied.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy retries server side errors and network failures up to 4
+// attempts in total.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second * 30,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatuses: map[int]bool{
+			http.StatusInternalServerError: true,
+			http.StatusBadGateway:          true,
+			// Twitter API returns 503 "Over capacity" when it is overloaded
+			http.StatusServiceUnavailable: true,
+			http.StatusGatewayTimeout:     true,
+		},
+		RetryNetworkErrors: true,
+	}
+}
+
+// NoRetryPolicy disables retrying, every failure is returned to the caller
+// immediately.
+func NoRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// retriesMethod returns true when requests of given http method can be
+// retried. Only GET requests are idempotent unless RetryNonIdempotent is set.
+func (p RetryPolicy) retriesMethod(method string) bool {
+	return method == http.MethodGet || p.RetryNonIdempotent
+}
+
+// shouldRetryStatus returns true when given status code is retryable for the
+// method and attempt is not the last one.
+func (p RetryPolicy) shouldRetryStatus(method string, status int, attempt int) bool {
+	return attempt < p.MaxAttempts && p.retriesMethod(method) && p.RetryableStatuses[status]
+}
+
+// shouldRetryError returns true when network errors are retryable for the
+// method and attempt is not the last one.
+func (p RetryPolicy) shouldRetryError(method string, attempt int) bool {
+	return attempt < p.MaxAttempts && p.retriesMethod(method) && p.RetryNetworkErrors
+}
+
+// backoff returns the wait duration after given failed attempt (starting from
+// 1). retryAfter is the raw Retry-After header value, which takes precedence
+// over the computed backoff when present.
+func (p RetryPolicy) backoff(attempt int, retryAfter string, now time.Time) time.Duration {
+	if d, ok := parseRetryAfter(retryAfter, now); ok {
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return d
+	}
+
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// parseRetryAfter parses Retry-After header value which is either a number of
+// seconds or a HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,209 @@
+package twitter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a client which sends requests to given test server
+// and records the retry wait times instead of sleeping.
+func newTestClient(srv *httptest.Server, policy RetryPolicy, waits *[]time.Duration) *twitterHTTPClient {
+	c := NewAuthBearerClient("test-bearer", WithBaseURL(srv.URL+"/2/"), WithRetryPolicy(policy))
+	c.sleep = func(d time.Duration) {
+		*waits = append(*waits, d)
+	}
+	return c
+}
+
+func testRetryPolicy() RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.Jitter = 0
+	return p
+}
+
+func TestSendGetRetry(t *testing.T) {
+	usersBody := `{"data":[{"id":"1","name":"Name","username":"user"}]}`
+
+	tests := []struct {
+		name string
+		// responses is the list of status codes returned by the server for
+		// each subsequent request. Last status is repeated.
+		responses   []int
+		headers     http.Header
+		policy      RetryPolicy
+		expectErr   bool
+		expectCalls int32
+		expectWaits []time.Duration
+	}{
+		{
+			name:        "ok no retry",
+			responses:   []int{200},
+			policy:      testRetryPolicy(),
+			expectCalls: 1,
+		},
+		{
+			name:        "retries server errors with exponential backoff",
+			responses:   []int{500, 503, 200},
+			policy:      testRetryPolicy(),
+			expectCalls: 3,
+			expectWaits: []time.Duration{time.Second, time.Second * 2},
+		},
+		{
+			name:        "gives up after max attempts",
+			responses:   []int{503},
+			policy:      testRetryPolicy(),
+			expectErr:   true,
+			expectCalls: 4,
+			expectWaits: []time.Duration{time.Second, time.Second * 2, time.Second * 4},
+		},
+		{
+			name:      "respects retry-after header",
+			responses: []int{503, 200},
+			headers: http.Header{
+				"Retry-After": []string{"7"},
+			},
+			policy:      testRetryPolicy(),
+			expectCalls: 2,
+			expectWaits: []time.Duration{time.Second * 7},
+		},
+		{
+			name:        "does not retry non retryable status",
+			responses:   []int{400},
+			policy:      testRetryPolicy(),
+			expectErr:   true,
+			expectCalls: 1,
+		},
+		{
+			name:        "does not retry rate limited requests",
+			responses:   []int{429},
+			policy:      testRetryPolicy(),
+			expectErr:   true,
+			expectCalls: 1,
+		},
+		{
+			name:        "retries disabled",
+			responses:   []int{503},
+			policy:      NoRetryPolicy(),
+			expectErr:   true,
+			expectCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := atomic.Int32{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(calls.Add(1)) - 1
+				if i >= len(tt.responses) {
+					i = len(tt.responses) - 1
+				}
+
+				assert.Equal(t, "Bearer test-bearer", r.Header.Get("Authorization"))
+				assert.Equal(t, "/2/users/by", r.URL.Path)
+
+				for k, v := range tt.headers {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(tt.responses[i])
+				if tt.responses[i] == 200 {
+					w.Write([]byte(usersBody))
+				}
+			}))
+			defer srv.Close()
+
+			waits := []time.Duration{}
+			c := newTestClient(srv, tt.policy, &waits)
+
+			resp, err := c.FindUserDetails([]string{"user"})
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Len(t, resp.Data, 1)
+			}
+
+			assert.Equal(t, tt.expectCalls, calls.Load())
+			if tt.expectWaits == nil {
+				assert.Empty(t, waits)
+			} else {
+				assert.Equal(t, tt.expectWaits, waits)
+			}
+		})
+	}
+}
+
+func TestSendGetRetryNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// Closed server refuses all connections
+	srv.Close()
+
+	waits := []time.Duration{}
+	c := newTestClient(srv, testRetryPolicy(), &waits)
+
+	_, err := c.FindUserDetails([]string{"user"})
+	assert.Error(t, err)
+	assert.Equal(t, []time.Duration{time.Second, time.Second * 2, time.Second * 4}, waits)
+}
+
+func TestSendPostRetry(t *testing.T) {
+	optIn := testRetryPolicy()
+	optIn.RetryNonIdempotent = true
+
+	tests := []struct {
+		name        string
+		policy      RetryPolicy
+		expectCalls int32
+	}{
+		{name: "not retried by default", policy: testRetryPolicy(), expectCalls: 1},
+		{name: "retried when opted in", policy: optIn, expectCalls: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := atomic.Int32{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				assert.Equal(t, http.MethodPost, r.Method)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			waits := []time.Duration{}
+			c := newTestClient(srv, tt.policy, &waits)
+
+			_, err := c.AddStreamRules([]StreamRule{{Value: "from:user"}}, false)
+			assert.Error(t, err)
+			assert.Equal(t, tt.expectCalls, calls.Load())
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	p := DefaultRetryPolicy()
+	p.Jitter = 0
+
+	assert.Equal(t, time.Second, p.backoff(1, "", now))
+	assert.Equal(t, time.Second*8, p.backoff(4, "", now))
+	// Capped by MaxBackoff
+	assert.Equal(t, time.Second*30, p.backoff(10, "", now))
+
+	// Retry-After as HTTP date
+	assert.Equal(t, time.Second*5, p.backoff(1, now.Add(time.Second*5).Format(http.TimeFormat), now))
+	// Retry-After capped by MaxBackoff
+	assert.Equal(t, time.Second*30, p.backoff(1, "600", now))
+
+	// Jitter stays within bounds
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2, "", now)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.LessOrEqual(t, d, time.Second*3)
+	}
+}
@@ -0,0 +1,263 @@
+package twitter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StreamRulesConfig is the desired set of filtered stream rules, for example
+// campaign hashtags and mentions of our handle.
+//
+//	{"rules": [{"value": "#d8x -is:retweet", "tag": "campaign"}, {"value": "@d8x_exchange", "tag": "mentions"}]}
+type StreamRulesConfig struct {
+	Rules []StreamRule `json:"rules"`
+}
+
+// LoadStreamRules reads the desired stream rules from a json config file.
+// Rules without value and rules with duplicate values are rejected.
+func LoadStreamRules(path string) ([]StreamRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading stream rules: %w", err)
+	}
+
+	cfg := StreamRulesConfig{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing stream rules %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for i, r := range cfg.Rules {
+		r.Value = strings.TrimSpace(r.Value)
+		if r.Value == "" {
+			return nil, fmt.Errorf("stream rule #%d has no value", i+1)
+		}
+		if seen[r.Value] {
+			return nil, fmt.Errorf("duplicate stream rule %q", r.Value)
+		}
+		seen[r.Value] = true
+		// Ids are assigned by the API
+		cfg.Rules[i] = StreamRule{Value: r.Value, Tag: r.Tag}
+	}
+	return cfg.Rules, nil
+}
+
+// ErrInvalidStreamRules is returned from RuleManager.Sync when the API rejects
+// some of the desired rules. Nothing is changed in that case.
+type ErrInvalidStreamRules struct {
+	Problems []ProblemDetail
+}
+
+func (e *ErrInvalidStreamRules) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = fmt.Sprintf("%s (%s)", p.Value, p.Title)
+	}
+	return "invalid stream rules: " + strings.Join(msgs, ", ")
+}
+
+// RuleSyncResult describes the changes made, or with dry run the changes that
+// would be made, by RuleManager.Sync.
+type RuleSyncResult struct {
+	DryRun bool
+
+	// Desired rules which were not active. Ids are set unless DryRun.
+	Added []StreamRule
+	// Active rules which are not desired anymore, or whose tag changed
+	Deleted []StreamRule
+	// Active rules which match the desired rules
+	Unchanged []StreamRule
+}
+
+// Changed returns true when rules were (or would be) added or deleted.
+func (r *RuleSyncResult) Changed() bool {
+	return len(r.Added) > 0 || len(r.Deleted) > 0
+}
+
+// RuleManager keeps the filtered stream rules in sync with a declarative set
+// of desired rules.
+type RuleManager struct {
+	Client StreamClient
+	Logger *slog.Logger
+}
+
+func NewRuleManager(c StreamClient) *RuleManager {
+	return &RuleManager{
+		Client: c,
+		Logger: slog.Default(),
+	}
+}
+
+// Sync diffs desired rules against the active rules and deletes and adds
+// rules so that exactly the desired rules are active. Rules are matched by
+// value and tag, a rule with a changed tag is deleted and added again. Added
+// rules are validated first and added before the obsolete rules are deleted,
+// so that a failed sync never leaves the stream without rules. Rules with a
+// changed tag can only be added after the old rule is deleted. With dryRun
+// the API only validates the changes.
+func (m *RuleManager) Sync(desired []StreamRule, dryRun bool) (*RuleSyncResult, error) {
+	active, err := m.Client.GetStreamRules()
+	if err != nil {
+		return nil, fmt.Errorf("fetching stream rules: %w", err)
+	}
+
+	result := &RuleSyncResult{DryRun: dryRun}
+
+	activeByValue := map[string]StreamRule{}
+	for _, r := range active.Data {
+		activeByValue[r.Value] = r
+	}
+	desiredByValue := map[string]StreamRule{}
+	for _, r := range desired {
+		desiredByValue[r.Value] = r
+	}
+
+	for _, r := range active.Data {
+		if d, ok := desiredByValue[r.Value]; ok && d.Tag == r.Tag {
+			result.Unchanged = append(result.Unchanged, r)
+		} else {
+			result.Deleted = append(result.Deleted, r)
+		}
+	}
+	// Rules with changed tags still exist until deleted, the API would
+	// report them as duplicates when validated or added
+	added := []StreamRule{}
+	retagged := []StreamRule{}
+	for _, r := range desired {
+		a, ok := activeByValue[r.Value]
+		if ok && a.Tag == r.Tag {
+			continue
+		}
+		result.Added = append(result.Added, StreamRule{Value: r.Value, Tag: r.Tag})
+		if ok {
+			retagged = append(retagged, result.Added[len(result.Added)-1])
+		} else {
+			added = append(added, result.Added[len(result.Added)-1])
+		}
+	}
+
+	if len(added) > 0 {
+		if _, err := m.add(added, true); err != nil {
+			return nil, fmt.Errorf("validating stream rules: %w", err)
+		}
+	}
+	if !dryRun {
+		if result.Added, err = m.add(added, false); err != nil {
+			return nil, fmt.Errorf("adding stream rules: %w", err)
+		}
+	}
+
+	if len(result.Deleted) > 0 {
+		ids := make([]string, len(result.Deleted))
+		for i, r := range result.Deleted {
+			ids[i] = r.Id
+		}
+		if _, err := m.Client.DeleteStreamRules(ids, dryRun); err != nil {
+			return nil, fmt.Errorf("deleting stream rules: %w", err)
+		}
+	}
+
+	if !dryRun {
+		data, err := m.add(retagged, false)
+		if err != nil {
+			return nil, fmt.Errorf("adding stream rules: %w", err)
+		}
+		result.Added = append(result.Added, data...)
+	}
+
+	m.Logger.Info("synced stream rules",
+		slog.Bool("dry_run", dryRun),
+		slog.Int("added", len(result.Added)),
+		slog.Int("deleted", len(result.Deleted)),
+		slog.Int("unchanged", len(result.Unchanged)),
+	)
+	return result, nil
+}
+
+// add adds rules and returns the added rules with their ids. Rules rejected
+// by the API are returned as ErrInvalidStreamRules.
+func (m *RuleManager) add(rules []StreamRule, dryRun bool) ([]StreamRule, error) {
+	if len(rules) == 0 {
+		return []StreamRule{}, nil
+	}
+	resp, err := m.Client.AddStreamRules(rules, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		return nil, &ErrInvalidStreamRules{Problems: resp.Errors}
+	}
+	return resp.Data, nil
+}
+
+// RuleMatchCounter reports which streamed tweets matched which rule tag. Rules
+// without a tag are counted by rule id. RuleMatchCounter is safe for concurrent
+// use.
+type RuleMatchCounter struct {
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	counts map[string]uint
+}
+
+func NewRuleMatchCounter() *RuleMatchCounter {
+	return &RuleMatchCounter{
+		Logger: slog.Default(),
+		counts: map[string]uint{},
+	}
+}
+
+// HandleTweet counts the matching rules of a streamed tweet. It can be passed
+// to StreamConsumer.Run directly.
+func (c *RuleMatchCounter) HandleTweet(t *StreamTweet) error {
+	tags := make([]string, len(t.MatchingRules))
+	for i, r := range t.MatchingRules {
+		tags[i] = r.Tag
+		if tags[i] == "" {
+			tags[i] = r.Id
+		}
+	}
+
+	c.mu.Lock()
+	for _, tag := range tags {
+		c.counts[tag]++
+	}
+	c.mu.Unlock()
+
+	c.Logger.Debug("tweet matched stream rules",
+		slog.String("tweet_id", t.Data.TweetId),
+		slog.String("tags", strings.Join(tags, ",")),
+	)
+	return nil
+}
+
+// Counts returns the number of matched tweets per rule tag.
+func (c *RuleMatchCounter) Counts() map[string]uint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return maps.Clone(c.counts)
+}
+
+// Tags returns the matched rule tags sorted by number of matches, most
+// matched first.
+func (c *RuleMatchCounter) Tags() []string {
+	counts := c.Counts()
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	return tags
+}
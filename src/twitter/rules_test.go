@@ -0,0 +1,212 @@
+package twitter
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRulesClient keeps stream rules in memory and records the calls
+type stubRulesClient struct {
+	StreamClient
+	rules   []StreamRule
+	invalid map[string]bool
+	// failAdd fails adding rules which are not a dry run
+	failAdd bool
+	calls   []string
+	nextId  int
+}
+
+func (s *stubRulesClient) GetStreamRules() (*StreamRulesResponse, error) {
+	s.calls = append(s.calls, "get")
+	return &StreamRulesResponse{Data: append([]StreamRule{}, s.rules...)}, nil
+}
+
+func (s *stubRulesClient) AddStreamRules(rules []StreamRule, dryRun bool) (*StreamRulesResponse, error) {
+	s.calls = append(s.calls, "add dry_run="+strconv.FormatBool(dryRun))
+	if s.failAdd && !dryRun {
+		return nil, &ErrAPI{StatusCode: 503}
+	}
+	resp := &StreamRulesResponse{}
+	for _, r := range rules {
+		if s.invalid[r.Value] {
+			resp.Errors = append(resp.Errors, ProblemDetail{Value: r.Value, Title: "InvalidRule"})
+			continue
+		}
+		s.nextId++
+		r.Id = strconv.Itoa(s.nextId)
+		resp.Data = append(resp.Data, r)
+	}
+	if !dryRun {
+		s.rules = append(s.rules, resp.Data...)
+	}
+	return resp, nil
+}
+
+func (s *stubRulesClient) DeleteStreamRules(ids []string, dryRun bool) (*StreamRulesResponse, error) {
+	s.calls = append(s.calls, "delete dry_run="+strconv.FormatBool(dryRun))
+	if dryRun {
+		return &StreamRulesResponse{}, nil
+	}
+	kept := []StreamRule{}
+	for _, r := range s.rules {
+		deleted := false
+		for _, id := range ids {
+			deleted = deleted || r.Id == id
+		}
+		if !deleted {
+			kept = append(kept, r)
+		}
+	}
+	s.rules = kept
+	return &StreamRulesResponse{}, nil
+}
+
+func TestRuleManagerSync(t *testing.T) {
+	active := []StreamRule{
+		{Id: "a", Value: "#d8x", Tag: "campaign"},
+		{Id: "b", Value: "@d8x_exchange", Tag: "old"},
+		{Id: "c", Value: "gm", Tag: "obsolete"},
+	}
+	desired := []StreamRule{
+		{Value: "#d8x", Tag: "campaign"},
+		{Value: "@d8x_exchange", Tag: "mentions"},
+		{Value: "#perps", Tag: "campaign"},
+	}
+
+	tests := []struct {
+		name      string
+		dryRun    bool
+		invalid   map[string]bool
+		failAdd   bool
+		wantErr   bool
+		wantCalls []string
+		wantRules []StreamRule
+	}{
+		{
+			name: "applies changes",
+			// New rules are added before deleting, retagged rules after
+			wantCalls: []string{"get", "add dry_run=true", "add dry_run=false", "delete dry_run=false", "add dry_run=false"},
+			wantRules: []StreamRule{
+				{Id: "a", Value: "#d8x", Tag: "campaign"},
+				// Validation of #perps consumed id 1
+				{Id: "2", Value: "#perps", Tag: "campaign"},
+				{Id: "3", Value: "@d8x_exchange", Tag: "mentions"},
+			},
+		},
+		{
+			name:      "dry run changes nothing",
+			dryRun:    true,
+			wantCalls: []string{"get", "add dry_run=true", "delete dry_run=true"},
+			wantRules: active,
+		},
+		{
+			name:      "invalid rule fails before deleting",
+			invalid:   map[string]bool{"#perps": true},
+			wantErr:   true,
+			wantCalls: []string{"get", "add dry_run=true"},
+			wantRules: active,
+		},
+		{
+			name:      "failed add keeps active rules",
+			failAdd:   true,
+			wantErr:   true,
+			wantCalls: []string{"get", "add dry_run=true", "add dry_run=false"},
+			wantRules: active,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &stubRulesClient{rules: append([]StreamRule{}, active...), invalid: tc.invalid, failAdd: tc.failAdd}
+			result, err := NewRuleManager(c).Sync(desired, tc.dryRun)
+
+			assert.Equal(t, tc.wantCalls, c.calls)
+			assert.Equal(t, tc.wantRules, c.rules)
+			if tc.failAdd {
+				assert.ErrorContains(t, err, "adding stream rules")
+				return
+			}
+			if tc.wantErr {
+				invalid := &ErrInvalidStreamRules{}
+				require.ErrorAs(t, err, &invalid)
+				assert.Equal(t, "#perps", invalid.Problems[0].Value)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, result.Changed())
+			assert.Equal(t, []StreamRule{active[0]}, result.Unchanged)
+			assert.Equal(t, active[1:], result.Deleted)
+			assert.Len(t, result.Added, 2)
+		})
+	}
+
+	t.Run("in sync", func(t *testing.T) {
+		c := &stubRulesClient{rules: []StreamRule{{Id: "a", Value: "#d8x", Tag: "campaign"}}}
+		result, err := NewRuleManager(c).Sync([]StreamRule{{Value: "#d8x", Tag: "campaign"}}, false)
+		require.NoError(t, err)
+		assert.False(t, result.Changed())
+		assert.Equal(t, []string{"get"}, c.calls)
+	})
+}
+
+func TestLoadStreamRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    []StreamRule
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			config: `{"rules": [{"value": " #d8x ", "tag": "campaign"}, {"id": "1", "value": "@d8x_exchange"}]}`,
+			want:   []StreamRule{{Value: "#d8x", Tag: "campaign"}, {Value: "@d8x_exchange"}},
+		},
+		{
+			name:    "empty value",
+			config:  `{"rules": [{"value": "#d8x"}, {"value": " ", "tag": "x"}]}`,
+			wantErr: "stream rule #2 has no value",
+		},
+		{
+			name:    "duplicate value",
+			config:  `{"rules": [{"value": "#d8x", "tag": "a"}, {"value": "#d8x", "tag": "b"}]}`,
+			wantErr: `duplicate stream rule "#d8x"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0o600))
+
+			rules, err := LoadStreamRules(path)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, rules)
+		})
+	}
+}
+
+func TestRuleMatchCounter(t *testing.T) {
+	c := NewRuleMatchCounter()
+	tweets := []*StreamTweet{
+		{Data: Tweet{TweetId: "1"}, MatchingRules: []MatchingRule{{Id: "10", Tag: "campaign"}, {Id: "11", Tag: "mentions"}}},
+		{Data: Tweet{TweetId: "2"}, MatchingRules: []MatchingRule{{Id: "10", Tag: "campaign"}}},
+		// Untagged rules are counted by id
+		{Data: Tweet{TweetId: "3"}, MatchingRules: []MatchingRule{{Id: "12"}}},
+	}
+	handle := StreamHandlers(c.HandleTweet)
+	for _, tweet := range tweets {
+		require.NoError(t, handle(tweet))
+	}
+
+	assert.Equal(t, map[string]uint{"campaign": 2, "mentions": 1, "12": 1}, c.Counts())
+	assert.Equal(t, []string{"campaign", "12", "mentions"}, c.Tags())
+}
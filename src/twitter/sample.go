@@ -0,0 +1,203 @@
+package twitter
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSampleRate is the share of all public tweets delivered by the
+// sampled stream (about 1%).
+const DefaultSampleRate = 0.01
+
+// StreamSink receives streamed tweets. InteractionUpdater, RuleMatchCounter,
+// FrequencyAggregator and JSONLinesSink are sinks.
+type StreamSink interface {
+	HandleTweet(t *StreamTweet) error
+}
+
+// StreamSinks passes each streamed tweet to all sinks in order, see
+// StreamHandlers.
+func StreamSinks(sinks ...StreamSink) func(*StreamTweet) error {
+	handlers := make([]func(*StreamTweet) error, len(sinks))
+	for i, s := range sinks {
+		handlers[i] = s.HandleTweet
+	}
+	return StreamHandlers(handlers...)
+}
+
+// NewSampledStream creates a consumer of tweets/sample/stream, a random sample
+// of all public tweets which is used as a baseline of general activity. It
+// shares the reconnect and stall handling with the filtered stream. Options
+// are merged with the fields needed for hashtag and mention frequencies.
+func NewSampledStream(c StreamClient, options ...ApiRequestOption) *StreamConsumer {
+	s := NewFilteredStream(c)
+	s.Endpoint = EndpointSampleStream
+	s.Options = append(options,
+		TweetFields(TweetFieldAuthorID, TweetFieldCreatedAt, TweetFieldEntities),
+	)
+	return s
+}
+
+// JSONLinesSink writes the raw json of each streamed tweet as a line to W.
+// JSONLinesSink is safe for concurrent use.
+type JSONLinesSink struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{W: w}
+}
+
+func (s *JSONLinesSink) HandleTweet(t *StreamTweet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.W.Write(append(append([]byte{}, t.Raw...), '\n'))
+	return err
+}
+
+// FrequencyEntry is the frequency of a single hashtag or mention.
+type FrequencyEntry struct {
+	// Lowercase hashtag without # or username without @
+	Key string
+	// Number of observed tweets containing Key
+	Count uint
+	// Share of observed tweets containing Key
+	Share float64
+	// Estimated number of all public tweets containing Key, Count scaled by
+	// the sample rate
+	Estimated float64
+	// Estimated number of all public tweets per hour containing Key
+	EstimatedPerHour float64
+}
+
+// FrequencySnapshot is the baseline activity observed by FrequencyAggregator.
+type FrequencySnapshot struct {
+	SampleRate float64
+	// Number of observed tweets
+	Tweets uint
+	// Estimated number of all public tweets in Window
+	EstimatedTweets float64
+	// Time between the first observed tweet and the snapshot
+	Window time.Duration
+
+	// Sorted by Count, most frequent first
+	Hashtags []FrequencyEntry
+	Mentions []FrequencyEntry
+}
+
+// FrequencyAggregator counts hashtag and mention frequencies of sampled
+// tweets. Counts are scaled by SampleRate to estimate the volume of all
+// public tweets. Each hashtag or mention is counted once per tweet.
+// FrequencyAggregator is safe for concurrent use.
+type FrequencyAggregator struct {
+	SampleRate float64
+
+	now func() time.Time
+
+	mu       sync.Mutex
+	tweets   uint
+	first    time.Time
+	hashtags map[string]uint
+	mentions map[string]uint
+}
+
+// NewFrequencyAggregator creates an aggregator for a stream sampled at
+// sampleRate, sampleRate <= 0 uses DefaultSampleRate.
+func NewFrequencyAggregator(sampleRate float64) *FrequencyAggregator {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &FrequencyAggregator{
+		SampleRate: sampleRate,
+		now:        time.Now,
+		hashtags:   map[string]uint{},
+		mentions:   map[string]uint{},
+	}
+}
+
+// HandleTweet counts the hashtags and mentions of a streamed tweet. Tweets
+// without entities only count towards the total.
+func (a *FrequencyAggregator) HandleTweet(t *StreamTweet) error {
+	if t.Data.TweetId == "" {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tweets == 0 {
+		a.first = a.now()
+	}
+	a.tweets++
+	if t.Data.Entities == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, h := range t.Data.Entities.Hashtags {
+		key := strings.ToLower(h.Tag)
+		if !seen["#"+key] {
+			seen["#"+key] = true
+			a.hashtags[key]++
+		}
+	}
+	for _, m := range t.Data.Entities.Mentions {
+		key := strings.ToLower(m.Username)
+		if !seen["@"+key] {
+			seen["@"+key] = true
+			a.mentions[key]++
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the current frequencies. When top > 0 only the top most
+// frequent hashtags and mentions are returned.
+func (a *FrequencyAggregator) Snapshot(top int) FrequencySnapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snap := FrequencySnapshot{
+		SampleRate:      a.SampleRate,
+		Tweets:          a.tweets,
+		EstimatedTweets: float64(a.tweets) / a.SampleRate,
+	}
+	if a.tweets > 0 {
+		snap.Window = a.now().Sub(a.first)
+	}
+	snap.Hashtags = a.entries(a.hashtags, snap.Window, top)
+	snap.Mentions = a.entries(a.mentions, snap.Window, top)
+	return snap
+}
+
+func (a *FrequencyAggregator) entries(counts map[string]uint, window time.Duration, top int) []FrequencyEntry {
+	ret := make([]FrequencyEntry, 0, len(counts))
+	for key, n := range counts {
+		e := FrequencyEntry{
+			Key:       key,
+			Count:     n,
+			Share:     float64(n) / float64(a.tweets),
+			Estimated: float64(n) / a.SampleRate,
+		}
+		if window > 0 {
+			e.EstimatedPerHour = e.Estimated / window.Hours()
+		}
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	if top > 0 && len(ret) > top {
+		ret = ret[:top]
+	}
+	return ret
+}
@@ -0,0 +1,75 @@
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrequencyAggregator(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := NewFrequencyAggregator(0)
+	a.now = func() time.Time { return now }
+
+	tweets := []*StreamTweet{
+		{Data: Tweet{TweetId: "1", Entities: &TweetEntities{
+			// Repeated hashtag counts once per tweet
+			Hashtags: []HashtagEntity{{Tag: "DeFi"}, {Tag: "defi"}, {Tag: "perps"}},
+			Mentions: []MentionEntity{{Username: "d8x_exchange"}},
+		}}},
+		{Data: Tweet{TweetId: "2", Entities: &TweetEntities{
+			Hashtags: []HashtagEntity{{Tag: "defi"}},
+		}}},
+		// Without entities only counts towards the total
+		{Data: Tweet{TweetId: "3"}},
+		{Data: Tweet{TweetId: "4"}},
+		// Disconnect messages are not tweets
+		{Errors: []ProblemDetail{{Title: "operational-disconnect"}}},
+	}
+	for i, tweet := range tweets {
+		if i == 1 {
+			now = now.Add(time.Minute * 30)
+		}
+		require.NoError(t, a.HandleTweet(tweet))
+	}
+
+	snap := a.Snapshot(0)
+	assert.Equal(t, DefaultSampleRate, snap.SampleRate)
+	assert.Equal(t, uint(4), snap.Tweets)
+	assert.InDelta(t, 400, snap.EstimatedTweets, 1e-9)
+	assert.Equal(t, time.Minute*30, snap.Window)
+	assert.Equal(t, []FrequencyEntry{
+		{Key: "defi", Count: 2, Share: 0.5, Estimated: 200, EstimatedPerHour: 400},
+		{Key: "perps", Count: 1, Share: 0.25, Estimated: 100, EstimatedPerHour: 200},
+	}, snap.Hashtags)
+	assert.Equal(t, []FrequencyEntry{
+		{Key: "d8x_exchange", Count: 1, Share: 0.25, Estimated: 100, EstimatedPerHour: 200},
+	}, snap.Mentions)
+
+	top := a.Snapshot(1)
+	assert.Len(t, top.Hashtags, 1)
+	assert.Equal(t, "defi", top.Hashtags[0].Key)
+
+	empty := NewFrequencyAggregator(0.1).Snapshot(0)
+	assert.Zero(t, empty.Window)
+	assert.Empty(t, empty.Hashtags)
+}
+
+func TestStreamSinks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lines := NewJSONLinesSink(buf)
+	freq := NewFrequencyAggregator(0)
+	handle := StreamSinks(lines, freq)
+
+	raw := `{"data":{"id":"1","text":"#gm","entities":{"hashtags":[{"start":0,"end":3,"tag":"gm"}]}}}`
+	tweet := &StreamTweet{Raw: json.RawMessage(raw)}
+	require.NoError(t, json.Unmarshal(tweet.Raw, tweet))
+	require.NoError(t, handle(tweet))
+
+	assert.Equal(t, raw+"\n", buf.String())
+	assert.Equal(t, uint(1), freq.Snapshot(0).Hashtags[0].Count)
+}
@@ -0,0 +1,524 @@
+package twitter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	EndpointSearchStream      Endpoint = "tweets/search/stream"
+	EndpointSearchStreamRules Endpoint = "tweets/search/stream/rules"
+	EndpointSampleStream      Endpoint = "tweets/sample/stream"
+)
+
+// StreamClient opens streaming connections and manages filtered stream rules.
+// Clients created by the client constructors implement StreamClient.
+type StreamClient interface {
+	// OpenStream connects to a streaming endpoint and returns the newline
+	// delimited response body. Failed connections return ErrRateLimited or
+	// ErrAPI.
+	OpenStream(ctx context.Context, endpoint Endpoint, options ...ApiRequestOption) (io.ReadCloser, error)
+
+	// GetStreamRules returns the active filtered stream rules.
+	GetStreamRules() (*StreamRulesResponse, error)
+
+	// AddStreamRules adds filtered stream rules. With dryRun the rules are
+	// only validated.
+	AddStreamRules(rules []StreamRule, dryRun bool) (*StreamRulesResponse, error)
+
+	// DeleteStreamRules deletes filtered stream rules by id. With dryRun
+	// nothing is deleted.
+	DeleteStreamRules(ids []string, dryRun bool) (*StreamRulesResponse, error)
+}
+
+var _ StreamClient = (*twitterHTTPClient)(nil)
+
+// StreamRule is a filtered stream rule. See
+// https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/integrate/build-a-rule
+type StreamRule struct {
+	Id    string `json:"id,omitempty"`
+	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// See
+// https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/api-reference/post-tweets-search-stream-rules
+type StreamRulesResponse struct {
+	Data   []StreamRule    `json:"data"`
+	Meta   StreamRulesMeta `json:"meta"`
+	Errors []ProblemDetail `json:"errors"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+type StreamRulesMeta struct {
+	Sent        string             `json:"sent"`
+	ResultCount int                `json:"result_count"`
+	Summary     StreamRulesSummary `json:"summary"`
+}
+
+type StreamRulesSummary struct {
+	Created    int `json:"created"`
+	NotCreated int `json:"not_created"`
+	Valid      int `json:"valid"`
+	Invalid    int `json:"invalid"`
+	Deleted    int `json:"deleted"`
+	NotDeleted int `json:"not_deleted"`
+}
+
+// StreamTweet is a single tweet delivered by a streaming endpoint.
+type StreamTweet struct {
+	Data     Tweet         `json:"data"`
+	Includes TweetIncludes `json:"includes"`
+
+	// Filtered stream rules which matched the tweet
+	MatchingRules []MatchingRule `json:"matching_rules"`
+
+	// Partial errors, or disconnect errors when Data is empty
+	Errors []ProblemDetail `json:"errors"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+type MatchingRule struct {
+	Id  string `json:"id"`
+	Tag string `json:"tag"`
+}
+
+// asTweetsResponse wraps the streamed tweet as a single tweet page so that it
+// can be processed the same way as timeline pages
+func (s *StreamTweet) asTweetsResponse() *TweetsResponse {
+	return &TweetsResponse{
+		Data:     []Tweet{s.Data},
+		Includes: s.Includes,
+		Errors:   s.Errors,
+		Raw:      s.Raw,
+	}
+}
+
+func (t *twitterHTTPClient) OpenStream(ctx context.Context, endpoint Endpoint, options ...ApiRequestOption) (io.ReadCloser, error) {
+	// Streams are long lived, client timeout would cut them off. Stalled
+	// connections are detected by the stream consumer instead.
+	hc := *t.r.GetClient()
+	hc.Timeout = 0
+	sr := resty.NewWithClient(&hc)
+	sr.Header = t.r.Header.Clone()
+
+	url := t.baseURL + string(endpoint)
+	refreshed := false
+	for {
+		req := sr.R().SetContext(ctx).SetDoNotParseResponse(true)
+		for _, opt := range options {
+			opt.Apply(req)
+		}
+		if err := t.auth.authenticate(req, resty.MethodGet, url); err != nil {
+			return nil, fmt.Errorf("authenticating request: %w", err)
+		}
+
+		resp, err := req.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() == 200 {
+			slog.Info("connected to twitter stream", slog.String("endpoint", string(endpoint)))
+			return resp.RawBody(), nil
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(resp.RawBody(), 1<<20))
+		resp.RawBody().Close()
+
+		if rf, ok := t.auth.(tokenRefresher); ok && resp.StatusCode() == 401 && !refreshed {
+			refreshed = true
+			if err := rf.refreshToken(); err == nil {
+				continue
+			}
+		}
+		return nil, responseError(resp.StatusCode(), resp.Header(), body)
+	}
+}
+
+func (t *twitterHTTPClient) GetStreamRules() (*StreamRulesResponse, error) {
+	body, err := t.sendGet(t.baseURL + string(EndpointSearchStreamRules))
+	if err != nil {
+		return nil, err
+	}
+	return parseStreamRules(body)
+}
+
+func (t *twitterHTTPClient) AddStreamRules(rules []StreamRule, dryRun bool) (*StreamRulesResponse, error) {
+	add := make([]StreamRule, len(rules))
+	for i, r := range rules {
+		add[i] = StreamRule{Value: r.Value, Tag: r.Tag}
+	}
+	return t.postStreamRules(map[string]any{"add": add}, dryRun)
+}
+
+func (t *twitterHTTPClient) DeleteStreamRules(ids []string, dryRun bool) (*StreamRulesResponse, error) {
+	return t.postStreamRules(map[string]any{"delete": map[string]any{"ids": ids}}, dryRun)
+}
+
+func (t *twitterHTTPClient) postStreamRules(body any, dryRun bool) (*StreamRulesResponse, error) {
+	options := []ApiRequestOption{}
+	if dryRun {
+		options = append(options, &OptApplyQueryParam{Key: "dry_run", Value: "true"})
+	}
+
+	respBody, err := t.sendPost(t.baseURL+string(EndpointSearchStreamRules), body, options...)
+	if err != nil {
+		return nil, err
+	}
+	return parseStreamRules(respBody)
+}
+
+func parseStreamRules(body []byte) (*StreamRulesResponse, error) {
+	ret := &StreamRulesResponse{
+		Raw: body,
+	}
+	if err := json.Unmarshal(body, ret); err != nil {
+		return nil, fmt.Errorf("parsing stream rules response: %w", err)
+	}
+	return ret, nil
+}
+
+// StreamReconnectPolicy controls the backoff between stream reconnects. The
+// defaults follow
+// https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/integrate/handling-disconnections
+type StreamReconnectPolicy struct {
+	// Network errors back off linearly by NetworkStep up to NetworkMax
+	NetworkStep time.Duration
+	NetworkMax  time.Duration
+
+	// HTTP errors back off exponentially from HTTPInitial up to HTTPMax
+	HTTPInitial time.Duration
+	HTTPMax     time.Duration
+
+	// HTTP 429 backs off exponentially from RateLimitInitial up to
+	// RateLimitMax
+	RateLimitInitial time.Duration
+	RateLimitMax     time.Duration
+}
+
+// DefaultStreamReconnectPolicy returns the reconnect backoff recommended by
+// the API documentation.
+func DefaultStreamReconnectPolicy() StreamReconnectPolicy {
+	return StreamReconnectPolicy{
+		NetworkStep:      time.Millisecond * 250,
+		NetworkMax:       time.Second * 16,
+		HTTPInitial:      time.Second * 5,
+		HTTPMax:          time.Second * 320,
+		RateLimitInitial: time.Minute,
+		RateLimitMax:     time.Minute * 16,
+	}
+}
+
+// wait returns the backoff before reconnect attempt (starting at 1) after err
+func (p StreamReconnectPolicy) wait(err error, attempt int) time.Duration {
+	exponential := func(initial, limit time.Duration) time.Duration {
+		d := initial
+		for i := 1; i < attempt && d < limit; i++ {
+			d *= 2
+		}
+		return min(d, limit)
+	}
+
+	erl := &ErrRateLimited{}
+	apiErr := &ErrAPI{}
+	switch {
+	case errors.As(err, &erl):
+		return exponential(p.RateLimitInitial, p.RateLimitMax)
+	case errors.As(err, &apiErr):
+		return exponential(p.HTTPInitial, p.HTTPMax)
+	default:
+		return min(p.NetworkStep*time.Duration(attempt), p.NetworkMax)
+	}
+}
+
+// ErrStreamDisconnected is returned by the stream reader when the API sends a
+// disconnect message, for example operational-disconnect.
+type ErrStreamDisconnected struct {
+	Errors []ProblemDetail
+}
+
+func (e *ErrStreamDisconnected) Error() string {
+	if len(e.Errors) == 0 {
+		return "stream disconnected"
+	}
+	return fmt.Sprintf("stream disconnected: %s %s", e.Errors[0].Title, e.Errors[0].Detail)
+}
+
+// isFatalStreamError returns true for errors which are not fixed by
+// reconnecting, such as invalid credentials or invalid request parameters
+func isFatalStreamError(err error) bool {
+	apiErr := &ErrAPI{}
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests
+}
+
+// StreamConsumer keeps a long lived connection to a streaming endpoint, parses
+// the newline delimited tweets and reconnects with backoff whenever the
+// connection drops or stalls.
+type StreamConsumer struct {
+	Client   StreamClient
+	Endpoint Endpoint
+	Options  []ApiRequestOption
+	Logger   *slog.Logger
+
+	Reconnect StreamReconnectPolicy
+
+	// StallTimeout closes the connection when nothing, not even the keep-alive
+	// heartbeat sent every 20 seconds, was received within it.
+	StallTimeout time.Duration
+
+	sleep func(context.Context, time.Duration) error
+}
+
+// defaultStreamOptions request the same fields and expansions as the timeline
+// endpoint so that streamed tweets can be processed the same way
+func defaultStreamOptions() []ApiRequestOption {
+	return []ApiRequestOption{
+		TweetFields(TweetFieldAuthorID, TweetFieldConversationID, TweetFieldCreatedAt, TweetFieldReferencedTweets, TweetFieldPublicMetrics),
+		Expansions(ExpansionAuthorID, ExpansionInReplyToUserID, ExpansionReferencedTweetsID, ExpansionReferencedTweetsIDAuthorID),
+		UserFields(UserFieldPublicMetrics),
+	}
+}
+
+// NewFilteredStream creates a consumer of tweets/search/stream. Only tweets
+// matching the stream rules (see StreamClient.AddStreamRules) are delivered.
+// Options are merged with the fields and expansions needed for interaction
+// counting.
+func NewFilteredStream(c StreamClient, options ...ApiRequestOption) *StreamConsumer {
+	return &StreamConsumer{
+		Client:       c,
+		Endpoint:     EndpointSearchStream,
+		Options:      append(options, defaultStreamOptions()...),
+		Logger:       slog.Default(),
+		Reconnect:    DefaultStreamReconnectPolicy(),
+		StallTimeout: time.Second * 30,
+		sleep:        sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// StreamHandlers combines handlers, for example InteractionUpdater and
+// RuleMatchCounter, into a single handler for Run. Handlers are called in
+// order and the first error stops the chain.
+func StreamHandlers(handlers ...func(*StreamTweet) error) func(*StreamTweet) error {
+	return func(t *StreamTweet) error {
+		for _, h := range handlers {
+			if err := h(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Run consumes the stream until ctx is done, handle returns an error or the
+// API responds with a non recoverable error. Each tweet is passed to handle in
+// the order it was received.
+func (s *StreamConsumer) Run(ctx context.Context, handle func(*StreamTweet) error) error {
+	if err := validateOptions(s.Endpoint, s.Options); err != nil {
+		return err
+	}
+
+	attempt := 0
+	for {
+		received, err := s.consume(ctx, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var handleErr *streamHandleError
+		if errors.As(err, &handleErr) {
+			return handleErr.err
+		}
+		if isFatalStreamError(err) {
+			return err
+		}
+
+		// Connection which delivered data resets the backoff
+		if received {
+			attempt = 0
+		}
+		attempt++
+
+		wait := s.Reconnect.wait(err, attempt)
+		erl := &ErrRateLimited{}
+		if errors.As(err, &erl) && erl.ResetTimestamp > 0 {
+			if untilReset := time.Until(time.Unix(erl.ResetTimestamp, 0)); untilReset > wait {
+				wait = untilReset
+			}
+		}
+
+		errMsg := "connection closed"
+		if err != nil {
+			errMsg = err.Error()
+		}
+		s.Logger.Warn("stream disconnected, reconnecting",
+			slog.String("endpoint", string(s.Endpoint)),
+			slog.Int("attempt", attempt),
+			slog.Duration("wait_time", wait),
+			slog.String("error", errMsg),
+		)
+		if err := s.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// streamHandleError wraps errors returned by the tweet handler
+type streamHandleError struct {
+	err error
+}
+
+func (e *streamHandleError) Error() string {
+	return e.err.Error()
+}
+
+// consume reads a single stream connection until it is closed. received is
+// true when at least one tweet was delivered.
+func (s *StreamConsumer) consume(ctx context.Context, handle func(*StreamTweet) error) (received bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	body, err := s.Client.OpenStream(ctx, s.Endpoint, s.Options...)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	// Close the connection when it stalls, this unblocks the reader
+	stalled := false
+	stallMu := sync.Mutex{}
+	var stallTimer *time.Timer
+	if s.StallTimeout > 0 {
+		stallTimer = time.AfterFunc(s.StallTimeout, func() {
+			stallMu.Lock()
+			stalled = true
+			stallMu.Unlock()
+			cancel()
+			body.Close()
+		})
+		defer stallTimer.Stop()
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10<<20)
+	for scanner.Scan() {
+		if stallTimer != nil {
+			stallTimer.Reset(s.StallTimeout)
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		// Empty lines are keep-alive heartbeats
+		if len(line) == 0 {
+			continue
+		}
+
+		tweet := &StreamTweet{Raw: append(json.RawMessage{}, line...)}
+		if err := json.Unmarshal(line, tweet); err != nil {
+			s.Logger.Warn("parsing stream message failed",
+				slog.String("error", err.Error()),
+				slog.String("message", string(line)),
+			)
+			continue
+		}
+		if tweet.Data.TweetId == "" {
+			if len(tweet.Errors) > 0 {
+				return received, &ErrStreamDisconnected{Errors: tweet.Errors}
+			}
+			continue
+		}
+
+		received = true
+		if err := handle(tweet); err != nil {
+			return received, &streamHandleError{err: err}
+		}
+	}
+
+	stallMu.Lock()
+	defer stallMu.Unlock()
+	if stalled {
+		return received, fmt.Errorf("stream stalled, nothing received in %s", s.StallTimeout)
+	}
+	return received, scanner.Err()
+}
+
+// InteractionUpdater incrementally updates UserInteractions of a single user
+// from streamed tweets, so that rankings are live. Only tweets authored by the
+// user are counted (replies, retweets and quotes), the same way as timeline
+// tweets are processed by Analyzer. InteractionUpdater is safe for concurrent
+// use.
+type InteractionUpdater struct {
+	UserTwitterId string
+
+	analyzer *Analyzer
+
+	mu     sync.Mutex
+	result *UserInteractions
+}
+
+// NewInteractionUpdater creates an updater for userTwitterId. Initial
+// interactions, for example a result of Analyzer.CreateUserInteractionGraph,
+// are continued when initial is not nil.
+func NewInteractionUpdater(userTwitterId string, initial *UserInteractions) *InteractionUpdater {
+	result := NewUserInteractionsObject()
+	if initial != nil {
+		result = initial.Clone()
+	}
+	result.UserTwitterId = userTwitterId
+
+	return &InteractionUpdater{
+		UserTwitterId: userTwitterId,
+		analyzer:      &Analyzer{Logger: slog.Default()},
+		result:        result,
+	}
+}
+
+// HandleTweet counts interactions of a streamed tweet. It can be passed to
+// StreamConsumer.Run directly.
+func (u *InteractionUpdater) HandleTweet(t *StreamTweet) error {
+	if t.Data.AuthorUserId != u.UserTwitterId {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.analyzer.ProcessDirectUserInteractions(t.asTweetsResponse(), u.result)
+
+	// Self replies and retweets are not interactions
+	removeSelfInteractions(u.result)
+	return nil
+}
+
+// Snapshot returns a copy of the current interactions.
+func (u *InteractionUpdater) Snapshot() *UserInteractions {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.result.Clone()
+}
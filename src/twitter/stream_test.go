@@ -0,0 +1,196 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamReconnectPolicyWait(t *testing.T) {
+	p := DefaultStreamReconnectPolicy()
+
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    time.Duration
+	}{
+		{"network first attempt", errors.New("connection reset"), 1, time.Millisecond * 250},
+		{"network grows linearly", errors.New("connection reset"), 4, time.Second},
+		{"network capped", errors.New("connection reset"), 1000, time.Second * 16},
+		{"http first attempt", &ErrAPI{StatusCode: 503}, 1, time.Second * 5},
+		{"http grows exponentially", &ErrAPI{StatusCode: 503}, 3, time.Second * 20},
+		{"http capped", &ErrAPI{StatusCode: 503}, 100, time.Second * 320},
+		{"rate limit first attempt", &ErrRateLimited{}, 1, time.Minute},
+		{"rate limit grows exponentially", &ErrRateLimited{}, 2, time.Minute * 2},
+		{"rate limit capped", &ErrRateLimited{}, 100, time.Minute * 16},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.wait(tc.err, tc.attempt))
+		})
+	}
+}
+
+// stubStreamClient serves the bodies or errors in order, one per OpenStream
+// call
+type stubStreamClient struct {
+	StreamClient
+	connections []func() (io.ReadCloser, error)
+	opened      int
+}
+
+func (s *stubStreamClient) OpenStream(ctx context.Context, endpoint Endpoint, options ...ApiRequestOption) (io.ReadCloser, error) {
+	s.opened++
+	if s.opened > len(s.connections) {
+		return nil, &ErrAPI{StatusCode: 401}
+	}
+	return s.connections[s.opened-1]()
+}
+
+func streamBody(lines ...string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(strings.Join(lines, "\r\n"))), nil
+	}
+}
+
+func streamError(err error) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return nil, err
+	}
+}
+
+func newTestStream(c StreamClient) (*StreamConsumer, *[]time.Duration) {
+	waits := []time.Duration{}
+	s := NewFilteredStream(c)
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return s, &waits
+}
+
+func TestStreamConsumer(t *testing.T) {
+	t.Run("parses tweets and reconnects", func(t *testing.T) {
+		c := &stubStreamClient{connections: []func() (io.ReadCloser, error){
+			streamBody(
+				`{"data":{"id":"1","author_id":"10","text":"first"},"matching_rules":[{"id":"100","tag":"seed"}]}`,
+				// Keep-alive heartbeat and malformed line are skipped
+				``,
+				`{"data":`,
+				`{"data":{"id":"2","author_id":"10","text":"second"}}`,
+				`{"errors":[{"title":"operational-disconnect","detail":"This stream has been disconnected upstream for operational reasons."}]}`,
+				`{"data":{"id":"not delivered"}}`,
+			),
+			streamError(errors.New("connection refused")),
+			streamError(&ErrAPI{StatusCode: 503}),
+			streamBody(`{"data":{"id":"3","author_id":"10","text":"third"}}`),
+		}}
+		s, waits := newTestStream(c)
+
+		ids := []string{}
+		err := s.Run(context.Background(), func(tweet *StreamTweet) error {
+			ids = append(ids, tweet.Data.TweetId)
+			return nil
+		})
+
+		// Stub responds with 401 after the last connection which stops the
+		// stream
+		assert.True(t, IsUnauthorized(err))
+		assert.Equal(t, []string{"1", "2", "3"}, ids)
+		assert.Equal(t, 5, c.opened)
+		assert.Equal(t, []time.Duration{
+			// Disconnect message
+			time.Millisecond * 250,
+			// Network error
+			time.Millisecond * 500,
+			// HTTP error
+			time.Second * 20,
+			// Stream closed after delivering tweet 3 resets the backoff
+			time.Millisecond * 250,
+		}, *waits)
+	})
+
+	t.Run("handler error stops the stream", func(t *testing.T) {
+		c := &stubStreamClient{connections: []func() (io.ReadCloser, error){
+			streamBody(`{"data":{"id":"1"}}`, `{"data":{"id":"2"}}`),
+		}}
+		s, _ := newTestStream(c)
+
+		handled := 0
+		err := s.Run(context.Background(), func(tweet *StreamTweet) error {
+			handled++
+			return errors.New("stop")
+		})
+		assert.EqualError(t, err, "stop")
+		assert.Equal(t, 1, handled)
+	})
+
+	t.Run("stalled connection is reconnected", func(t *testing.T) {
+		stalled, _ := io.Pipe()
+		c := &stubStreamClient{connections: []func() (io.ReadCloser, error){
+			func() (io.ReadCloser, error) { return stalled, nil },
+		}}
+		s, waits := newTestStream(c)
+		s.StallTimeout = time.Millisecond * 20
+
+		err := s.Run(context.Background(), func(tweet *StreamTweet) error { return nil })
+		assert.True(t, IsUnauthorized(err))
+		assert.Equal(t, []time.Duration{time.Millisecond * 250}, *waits)
+	})
+
+	t.Run("context cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		c := &stubStreamClient{connections: []func() (io.ReadCloser, error){
+			streamError(context.Canceled),
+		}}
+		s, _ := newTestStream(c)
+		assert.ErrorIs(t, s.Run(ctx, func(tweet *StreamTweet) error { return nil }), context.Canceled)
+	})
+}
+
+func TestInteractionUpdater(t *testing.T) {
+	initial := NewUserInteractionsObject()
+	initial.UserTwitterId = "10"
+	initial.UserLikedTweets["30"] = 2
+
+	u := NewInteractionUpdater("10", initial)
+
+	tweets := []*StreamTweet{
+		{Data: Tweet{TweetId: "1", AuthorUserId: "10", InReplyToUserId: "20"}},
+		{
+			Data: Tweet{TweetId: "2", AuthorUserId: "10", ReferencedTweets: []ReferencedTweetMeta{{Type: Retweet, Id: "5"}}},
+			Includes: TweetIncludes{
+				Tweets: []Tweet{{TweetId: "5", AuthorUserId: "20"}},
+				Users:  []UserDetail{{Id: "20", Username: "twenty"}},
+			},
+		},
+		// Self reply is not an interaction
+		{Data: Tweet{TweetId: "3", AuthorUserId: "10", InReplyToUserId: "10"}},
+		// Tweets of other users are ignored
+		{Data: Tweet{TweetId: "4", AuthorUserId: "20", InReplyToUserId: "10"}},
+	}
+	for _, tweet := range tweets {
+		require.NoError(t, u.HandleTweet(tweet))
+	}
+
+	snapshot := u.Snapshot()
+	assert.Equal(t, map[string]uint{"20": 1}, snapshot.RepliesToOtherUsers)
+	assert.Equal(t, map[string]uint{"20": 1}, snapshot.RetweetsToOtherUsers)
+	assert.Equal(t, map[string]uint{"30": 2}, snapshot.UserLikedTweets)
+	assert.Equal(t, map[string]string{"20": "twenty"}, snapshot.Usernames)
+
+	// Snapshot is a copy and initial interactions are not modified
+	snapshot.RepliesToOtherUsers["20"] = 100
+	assert.Equal(t, uint(1), u.Snapshot().RepliesToOtherUsers["20"])
+	assert.Empty(t, initial.RepliesToOtherUsers)
+}
@@ -0,0 +1,321 @@
+package twitter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// InteractionKind is the category of an InteractionEvent.
+type InteractionKind string
+
+const (
+	InteractionReply   InteractionKind = "reply"
+	InteractionRetweet InteractionKind = "retweet"
+	InteractionQuote   InteractionKind = "quote"
+	InteractionLike    InteractionKind = "like"
+	InteractionMention InteractionKind = "mention"
+)
+
+// InteractionEvent is a single timestamped interaction of the analyzed user
+// with a counterpart user.
+type InteractionEvent struct {
+	UserId        string          `json:"user_id"`
+	CounterpartId string          `json:"counterpart_id"`
+	Kind          InteractionKind `json:"kind"`
+	TweetId       string          `json:"tweet_id"`
+	At            time.Time       `json:"at"`
+}
+
+// TimelineEvents extracts the interaction events of userId from a page of
+// the user's timeline. Replies, retweets and quotes are timestamped with the
+// creation time of the user's tweet. Mentions (requires the entities tweet
+// field) other than the replied to user are reported as well, except for
+// retweets whose mentions are written by the original author and the
+// @handles prefixed to replies. Tweets without creation time are skipped.
+func TimelineEvents(userId string, r *TweetsResponse) []InteractionEvent {
+	events := []InteractionEvent{}
+	for i := range r.Data {
+		tweet := &r.Data[i]
+		at, err := time.Parse(time.RFC3339, tweet.CreatedAt)
+		if err != nil {
+			continue
+		}
+		add := func(counterpartId string, kind InteractionKind) {
+			if counterpartId == "" || counterpartId == userId {
+				return
+			}
+			events = append(events, InteractionEvent{
+				UserId:        userId,
+				CounterpartId: counterpartId,
+				Kind:          kind,
+				TweetId:       tweet.TweetId,
+				At:            at,
+			})
+		}
+
+		// Same attribution as Analyzer.ProcessDirectUserInteractions,
+		// references of replies are the replied to tweet
+		if tweet.InReplyToUserId != "" {
+			add(tweet.InReplyToUserId, InteractionReply)
+		} else {
+			for _, ref := range tweet.ReferencedTweets {
+				original := r.FindReferencedTweet(ref.Id)
+				if original == nil {
+					continue
+				}
+				switch ref.Type {
+				case Retweet:
+					add(original.AuthorUserId, InteractionRetweet)
+				case Quoted:
+					add(original.AuthorUserId, InteractionQuote)
+				}
+			}
+		}
+
+		// Mentions of a retweet are the "RT @author:" prefix and the mentions
+		// written by the original author
+		if tweet.Entities != nil && !isRetweet(tweet) {
+			prefixEnd := replyPrefixEnd(tweet)
+			for _, m := range tweet.Entities.Mentions {
+				if m.Id != tweet.InReplyToUserId && m.Start >= prefixEnd {
+					add(m.Id, InteractionMention)
+				}
+			}
+		}
+	}
+	return events
+}
+
+// replyPrefixEnd returns the offset where the text of a reply starts after
+// the @handles inserted for the replied to users. Tweets archived without
+// display_text_range use the run of mentions at the start of the text.
+func replyPrefixEnd(tweet *Tweet) int {
+	if tweet.InReplyToUserId == "" {
+		return 0
+	}
+	if len(tweet.DisplayTextRange) == 2 {
+		return tweet.DisplayTextRange[0]
+	}
+	end := 0
+	for _, m := range tweet.Entities.Mentions {
+		if m.Start != end {
+			break
+		}
+		// Handles are separated by a single space
+		end = m.End + 1
+	}
+	return end
+}
+
+// isRetweet returns true when tweet is a retweet of another tweet
+func isRetweet(tweet *Tweet) bool {
+	for _, ref := range tweet.ReferencedTweets {
+		if ref.Type == Retweet {
+			return true
+		}
+	}
+	return false
+}
+
+// LikedTweetsEvents extracts like events of userId from a page of the user's
+// liked tweets. The API does not report when a tweet was liked, likes are
+// timestamped with the creation time of the liked tweet instead.
+func LikedTweetsEvents(userId string, r *TweetsResponse) []InteractionEvent {
+	events := []InteractionEvent{}
+	for _, tweet := range r.Data {
+		at, err := time.Parse(time.RFC3339, tweet.CreatedAt)
+		if err != nil || tweet.AuthorUserId == "" || tweet.AuthorUserId == userId {
+			continue
+		}
+		events = append(events, InteractionEvent{
+			UserId:        userId,
+			CounterpartId: tweet.AuthorUserId,
+			Kind:          InteractionLike,
+			TweetId:       tweet.TweetId,
+			At:            at,
+		})
+	}
+	return events
+}
+
+// ArchiveEvents extracts the interaction events of userId from an archive
+// written by ArchivingClient. Events of tweets archived by several runs are
+// reported once.
+func ArchiveEvents(archive io.Reader, userId string) ([]InteractionEvent, error) {
+	events := []InteractionEvent{}
+	seen := map[InteractionEvent]bool{}
+	err := ReadArchive(archive, func(page *ArchivedPage) error {
+		if page.Id != userId || (page.Endpoint != EndpointUserTweets && page.Endpoint != EndpointUserLikedTweets) {
+			return nil
+		}
+
+		tweets, err := page.tweets()
+		if err != nil {
+			return err
+		}
+		pageEvents := LikedTweetsEvents(userId, tweets)
+		if page.Endpoint == EndpointUserTweets {
+			pageEvents = TimelineEvents(userId, tweets)
+		}
+		for _, e := range pageEvents {
+			if !seen[e] {
+				seen[e] = true
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// Granularity is the bucket size of a time series.
+type Granularity string
+
+const (
+	Daily Granularity = "daily"
+	// Weekly buckets start on Monday
+	Weekly Granularity = "weekly"
+)
+
+// bucketStart returns the start of the bucket containing t in UTC
+func (g Granularity) bucketStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if g == Weekly {
+		// Monday is the first day of the week
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func (g Granularity) next(start time.Time) time.Time {
+	if g == Weekly {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// SeriesPoint are the interaction counts of a single time bucket.
+type SeriesPoint struct {
+	Start    time.Time `json:"start"`
+	Replies  uint      `json:"replies"`
+	Retweets uint      `json:"retweets"`
+	Quotes   uint      `json:"quotes"`
+	Likes    uint      `json:"likes"`
+	Mentions uint      `json:"mentions"`
+}
+
+// Total returns the sum of all categories.
+func (p SeriesPoint) Total() uint {
+	return p.Replies + p.Retweets + p.Quotes + p.Likes + p.Mentions
+}
+
+func (p *SeriesPoint) add(kind InteractionKind) {
+	switch kind {
+	case InteractionReply:
+		p.Replies++
+	case InteractionRetweet:
+		p.Retweets++
+	case InteractionQuote:
+		p.Quotes++
+	case InteractionLike:
+		p.Likes++
+	case InteractionMention:
+		p.Mentions++
+	}
+}
+
+// InteractionEvents is a set of events which can be queried as time series.
+type InteractionEvents []InteractionEvent
+
+// Series returns the per counterpart time series of the events in [from, to).
+// Every series has a point for each bucket in the range, including empty
+// ones. Key is the counterpart user id.
+func (e InteractionEvents) Series(g Granularity, from, to time.Time) map[string][]SeriesPoint {
+	buckets := []time.Time{}
+	for start := g.bucketStart(from); start.Before(to); start = g.next(start) {
+		buckets = append(buckets, start)
+	}
+	index := make(map[time.Time]int, len(buckets))
+	for i, b := range buckets {
+		index[b] = i
+	}
+
+	ret := map[string][]SeriesPoint{}
+	for _, ev := range e {
+		if ev.At.Before(from) || !ev.At.Before(to) {
+			continue
+		}
+		series, ok := ret[ev.CounterpartId]
+		if !ok {
+			series = make([]SeriesPoint, len(buckets))
+			for i, b := range buckets {
+				series[i].Start = b
+			}
+			ret[ev.CounterpartId] = series
+		}
+		series[index[g.bucketStart(ev.At)]].add(ev.Kind)
+	}
+	return ret
+}
+
+// Pair returns the time series of interactions of userId with counterpartId
+// in [from, to). Points of buckets without interactions are zero.
+func (e InteractionEvents) Pair(userId, counterpartId string, g Granularity, from, to time.Time) []SeriesPoint {
+	pair := InteractionEvents{}
+	for _, ev := range e {
+		if ev.UserId == userId && ev.CounterpartId == counterpartId {
+			pair = append(pair, ev)
+		}
+	}
+
+	if series, ok := pair.Series(g, from, to)[counterpartId]; ok {
+		return series
+	}
+	// No interactions, still report the empty buckets
+	empty := []SeriesPoint{}
+	for start := g.bucketStart(from); start.Before(to); start = g.next(start) {
+		empty = append(empty, SeriesPoint{Start: start})
+	}
+	return empty
+}
+
+// WriteSeriesCSV writes series as CSV with one row per counterpart and
+// bucket, ordered by counterpart id and time:
+//
+//	counterpart_id,start,replies,retweets,quotes,likes,mentions,total
+func WriteSeriesCSV(w io.Writer, series map[string][]SeriesPoint) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"counterpart_id", "start", "replies", "retweets", "quotes", "likes", "mentions", "total"}); err != nil {
+		return err
+	}
+
+	counterparts := make([]string, 0, len(series))
+	for id := range series {
+		counterparts = append(counterparts, id)
+	}
+	sort.Strings(counterparts)
+
+	u := func(n uint) string { return strconv.FormatUint(uint64(n), 10) }
+	for _, id := range counterparts {
+		for _, p := range series[id] {
+			err := cw.Write([]string{
+				id, p.Start.Format(time.DateOnly),
+				u(p.Replies), u(p.Retweets), u(p.Quotes), u(p.Likes), u(p.Mentions), u(p.Total()),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing series csv: %w", err)
+	}
+	return nil
+}
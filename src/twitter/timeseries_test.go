@@ -0,0 +1,107 @@
+package twitter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(d int) time.Time {
+	// 2024-01-01 is a Monday
+	return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestTimelineAndLikedTweetsEvents(t *testing.T) {
+	timeline := parseTweets(t, `{"data":[
+		{"id":"1","author_id":"10","created_at":"2024-01-02T10:00:00.000Z","in_reply_to_user_id":"20","text":"@twenty hi @thirty","display_text_range":[8,18],"entities":{"mentions":[{"start":0,"end":7,"username":"twenty","id":"20"},{"start":11,"end":18,"username":"thirty","id":"30"}]}},
+		{"id":"8","author_id":"10","created_at":"2024-01-02T11:00:00.000Z","in_reply_to_user_id":"20","text":"@twenty @fifty thanks @thirty","display_text_range":[15,29],"entities":{"mentions":[{"start":0,"end":7,"username":"twenty","id":"20"},{"start":8,"end":14,"username":"fifty","id":"50"},{"start":22,"end":29,"username":"thirty","id":"30"}]}},
+		{"id":"9","author_id":"10","created_at":"2024-01-02T12:00:00.000Z","in_reply_to_user_id":"20","text":"@twenty @fifty thanks @thirty","entities":{"mentions":[{"start":0,"end":7,"username":"twenty","id":"20"},{"start":8,"end":14,"username":"fifty","id":"50"},{"start":22,"end":29,"username":"thirty","id":"30"}]}},
+		{"id":"2","author_id":"10","created_at":"2024-01-03T10:00:00.000Z","referenced_tweets":[{"type":"retweeted","id":"100"}],"entities":{"mentions":[{"username":"thirty","id":"30"},{"username":"forty","id":"40"}]}},
+		{"id":"3","author_id":"10","created_at":"2024-01-09T10:00:00.000Z","referenced_tweets":[{"type":"quoted","id":"101"}]},
+		{"id":"4","author_id":"10","created_at":"2024-01-09T11:00:00.000Z","in_reply_to_user_id":"10"},
+		{"id":"5","author_id":"10","in_reply_to_user_id":"20"}
+	],"includes":{"tweets":[{"id":"100","author_id":"30"},{"id":"101","author_id":"20"}]}}`)
+
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts
+	}
+	assert.Equal(t, []InteractionEvent{
+		{UserId: "10", CounterpartId: "20", Kind: InteractionReply, TweetId: "1", At: at("2024-01-02T10:00:00Z")},
+		// Replied to user is not counted as mention again
+		{UserId: "10", CounterpartId: "30", Kind: InteractionMention, TweetId: "1", At: at("2024-01-02T10:00:00Z")},
+		// Handles of the other thread participants prefixed to the reply are
+		// not mentions, with or without display text range
+		{UserId: "10", CounterpartId: "20", Kind: InteractionReply, TweetId: "8", At: at("2024-01-02T11:00:00Z")},
+		{UserId: "10", CounterpartId: "30", Kind: InteractionMention, TweetId: "8", At: at("2024-01-02T11:00:00Z")},
+		{UserId: "10", CounterpartId: "20", Kind: InteractionReply, TweetId: "9", At: at("2024-01-02T12:00:00Z")},
+		{UserId: "10", CounterpartId: "30", Kind: InteractionMention, TweetId: "9", At: at("2024-01-02T12:00:00Z")},
+		// Retweeted author and the original tweet's mentions are not mentions
+		{UserId: "10", CounterpartId: "30", Kind: InteractionRetweet, TweetId: "2", At: at("2024-01-03T10:00:00Z")},
+		{UserId: "10", CounterpartId: "20", Kind: InteractionQuote, TweetId: "3", At: at("2024-01-09T10:00:00Z")},
+	}, TimelineEvents("10", timeline))
+
+	liked := parseTweets(t, `{"data":[
+		{"id":"6","author_id":"20","created_at":"2024-01-04T10:00:00.000Z"},
+		{"id":"7","author_id":"10","created_at":"2024-01-04T10:00:00.000Z"}
+	]}`)
+	assert.Equal(t, []InteractionEvent{
+		{UserId: "10", CounterpartId: "20", Kind: InteractionLike, TweetId: "6", At: at("2024-01-04T10:00:00Z")},
+	}, LikedTweetsEvents("10", liked))
+}
+
+func TestInteractionEventsSeries(t *testing.T) {
+	events := InteractionEvents{
+		{UserId: "10", CounterpartId: "20", Kind: InteractionReply, At: day(1).Add(time.Hour)},
+		{UserId: "10", CounterpartId: "20", Kind: InteractionLike, At: day(1).Add(time.Hour * 2)},
+		{UserId: "10", CounterpartId: "20", Kind: InteractionQuote, At: day(3)},
+		{UserId: "10", CounterpartId: "30", Kind: InteractionMention, At: day(8)},
+		{UserId: "10", CounterpartId: "30", Kind: InteractionRetweet, At: day(9)},
+		// Outside of the range
+		{UserId: "10", CounterpartId: "40", Kind: InteractionReply, At: day(15)},
+	}
+
+	t.Run("daily", func(t *testing.T) {
+		series := events.Series(Daily, day(1), day(4))
+		assert.Equal(t, []SeriesPoint{
+			{Start: day(1), Replies: 1, Likes: 1},
+			{Start: day(2)},
+			{Start: day(3), Quotes: 1},
+		}, series["20"])
+		assert.NotContains(t, series, "30")
+	})
+
+	t.Run("weekly", func(t *testing.T) {
+		// Range starting mid-week is bucketed from Monday
+		series := events.Series(Weekly, day(3), day(15))
+		assert.Equal(t, []SeriesPoint{{Start: day(1), Quotes: 1}, {Start: day(8)}}, series["20"])
+		assert.Equal(t, []SeriesPoint{{Start: day(1)}, {Start: day(8), Retweets: 1, Mentions: 1}}, series["30"])
+		assert.Equal(t, uint(2), series["30"][1].Total())
+	})
+
+	t.Run("pair", func(t *testing.T) {
+		// Interactions of another analyzed user with the same counterpart
+		withOther := append(InteractionEvents{
+			{UserId: "11", CounterpartId: "20", Kind: InteractionReply, At: day(2)},
+		}, events...)
+		assert.Equal(t, []SeriesPoint{
+			{Start: day(1), Replies: 1, Likes: 1, Quotes: 1},
+			{Start: day(8)},
+		}, withOther.Pair("10", "20", Weekly, day(1), day(15)))
+		assert.Equal(t, []SeriesPoint{{Start: day(1)}, {Start: day(2)}}, events.Pair("10", "99", Daily, day(1), day(3)))
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteSeriesCSV(buf, events.Series(Weekly, day(1), day(15))))
+		assert.Equal(t, "counterpart_id,start,replies,retweets,quotes,likes,mentions,total\n"+
+			"20,2024-01-01,1,0,1,1,0,3\n"+
+			"20,2024-01-08,0,0,0,0,0,0\n"+
+			"30,2024-01-01,0,0,0,0,0,0\n"+
+			"30,2024-01-08,0,1,0,0,1,2\n", buf.String())
+	})
+}
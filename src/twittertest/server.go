@@ -0,0 +1,722 @@
+// Package twittertest provides an in-process fake of the Twitter V2 API for
+// integration tests of twitter.Client and twitter.Analyzer.
+package twittertest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+)
+
+// Fixtures is the data served by the fake server.
+type Fixtures struct {
+	Users []twitter.UserDetail `json:"users"`
+
+	// Tweets of all users. User timeline consists of the user's tweets in the
+	// order they are listed here, so list them from newest to oldest.
+	// Retweets and quotes reference other tweets via ReferencedTweets,
+	// referenced tweets which are not listed here are reported as deleted.
+	Tweets []twitter.Tweet `json:"tweets"`
+
+	// Likes maps user id to the liked tweet ids, newest first.
+	Likes map[string][]string `json:"likes"`
+}
+
+// LoadFixtures reads json encoded Fixtures from path.
+func LoadFixtures(path string) (*Fixtures, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixtures{}
+	if err := json.Unmarshal(contents, f); err != nil {
+		return nil, fmt.Errorf("parsing fixtures: %w", err)
+	}
+	return f, nil
+}
+
+// Fault is an injected failure returned instead of the regular response.
+type Fault struct {
+	// Endpoint to fail, empty matches all endpoints
+	Endpoint twitter.Endpoint
+
+	// Skip the first Skip matching requests before failing
+	Skip int
+	// Times is the number of requests to fail, 0 fails all of them
+	Times int
+
+	// Status code and body of the failed response. Body defaults to a
+	// problem details json for Status.
+	Status  int
+	Body    string
+	Headers http.Header
+
+	// Delay before responding, useful for timeout tests
+	Delay time.Duration
+
+	matched int
+}
+
+// rateLimit is a fixed window rate limit of a single endpoint
+type rateLimit struct {
+	requests int
+	window   time.Duration
+
+	count       int
+	windowStart time.Time
+}
+
+// Server is a fake Twitter V2 API server. It implements users/:id/tweets,
+// users/:id/liked_tweets, tweets/:id/liking_users, tweets/:id/retweeted_by
+// and users/by endpoints with pagination, includes, rate limits and fault
+// injection, the filtered stream with its rules endpoints and the sampled
+// stream.
+type Server struct {
+	*httptest.Server
+
+	// Now returns the current time for rate limit windows
+	Now func() time.Time
+
+	// KeepAlive is the interval of stream heartbeats, 20 seconds by default
+	KeepAlive time.Duration
+
+	mu       sync.Mutex
+	users    map[string]twitter.UserDetail
+	tweets   map[string]twitter.Tweet
+	fixtures *Fixtures
+	limits   map[twitter.Endpoint]*rateLimit
+	faults   []*Fault
+	requests map[twitter.Endpoint]int
+
+	rules      []twitter.StreamRule
+	nextRuleId int
+	streams    map[*streamConn]bool
+}
+
+// NewServer starts a fake server serving f.
+func NewServer(f *Fixtures) *Server {
+	s := &Server{
+		Now:      time.Now,
+		users:    map[string]twitter.UserDetail{},
+		tweets:   map[string]twitter.Tweet{},
+		fixtures: f,
+		limits:   map[twitter.Endpoint]*rateLimit{},
+		requests: map[twitter.Endpoint]int{},
+		streams:  map[*streamConn]bool{},
+	}
+	for _, u := range f.Users {
+		s.users[u.Id] = u
+	}
+	for _, t := range f.Tweets {
+		s.tweets[t.TweetId] = t
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// BaseURL returns the url to be used with twitter.WithBaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/2/"
+}
+
+// Client creates a bearer token client pointed at the server.
+func (s *Server) Client(options ...twitter.ClientOption) twitter.Client {
+	return twitter.NewAuthBearerClient("twittertest-token",
+		append([]twitter.ClientOption{twitter.WithBaseURL(s.BaseURL())}, options...)...,
+	)
+}
+
+// SetRateLimit limits endpoint to requests per window. Requests over the limit
+// are rejected with HTTP 429 and x-rate-limit-reset header.
+func (s *Server) SetRateLimit(endpoint twitter.Endpoint, requests int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits[endpoint] = &rateLimit{requests: requests, window: window}
+}
+
+// InjectFault adds a fault. Faults are matched in the order they were added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// RequestCount returns the number of requests received for endpoint,
+// including the rejected ones.
+func (s *Server) RequestCount(endpoint twitter.Endpoint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// route matches the request path to an endpoint and returns the path id.
+func route(path string) (twitter.Endpoint, string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "2" {
+		return "", "", false
+	}
+	parts = parts[1:]
+
+	switch {
+	case strings.Join(parts, "/") == string(twitter.EndpointSearchStream):
+		return twitter.EndpointSearchStream, "", true
+	case strings.Join(parts, "/") == string(twitter.EndpointSearchStreamRules):
+		return twitter.EndpointSearchStreamRules, "", true
+	case strings.Join(parts, "/") == string(twitter.EndpointSampleStream):
+		return twitter.EndpointSampleStream, "", true
+	case len(parts) == 2 && parts[0] == "users" && parts[1] == "by":
+		return twitter.EndpointUserLookup, "", true
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "tweets":
+		return twitter.EndpointUserTweets, parts[1], true
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "liked_tweets":
+		return twitter.EndpointUserLikedTweets, parts[1], true
+	case len(parts) == 3 && parts[0] == "tweets" && parts[2] == "liking_users":
+		return twitter.EndpointTweetLikers, parts[1], true
+	case len(parts) == 3 && parts[0] == "tweets" && parts[2] == "retweeted_by":
+		return twitter.EndpointTweetRetweeters, parts[1], true
+	}
+	return "", "", false
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, id, ok := route(r.URL.Path)
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "Not Found Error", "Unknown endpoint "+r.URL.Path, "about:blank")
+		return
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		writeProblem(w, http.StatusUnauthorized, "Unauthorized", "Unauthorized", "about:blank")
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[endpoint]++
+	fault := s.matchFault(endpoint)
+	limited, limitHeaders := s.checkRateLimit(endpoint)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			time.Sleep(fault.Delay)
+		}
+		for k, v := range fault.Headers {
+			w.Header()[k] = v
+		}
+		if fault.Body != "" {
+			w.WriteHeader(fault.Status)
+			w.Write([]byte(fault.Body))
+		} else {
+			writeProblem(w, fault.Status, http.StatusText(fault.Status), http.StatusText(fault.Status), "about:blank")
+		}
+		return
+	}
+
+	for k, v := range limitHeaders {
+		w.Header()[k] = v
+	}
+	if limited {
+		writeProblem(w, http.StatusTooManyRequests, "Too Many Requests", "Too Many Requests", "about:blank")
+		return
+	}
+
+	q := r.URL.Query()
+	switch endpoint {
+	case twitter.EndpointSearchStream, twitter.EndpointSampleStream:
+		s.serveStream(w, r, endpoint, q)
+		return
+	case twitter.EndpointSearchStreamRules:
+		s.serveStreamRules(w, r, q)
+		return
+	}
+
+	// Fixtures are modified by PushTweet while responses are built
+	s.mu.Lock()
+	var resp any
+	var err *problem
+	switch endpoint {
+	case twitter.EndpointUserLookup:
+		resp = s.userLookup(q.Get("usernames"), q)
+	case twitter.EndpointUserTweets:
+		resp, err = s.userTweets(id, q)
+	case twitter.EndpointUserLikedTweets:
+		resp, err = s.likedTweets(id, q)
+	case twitter.EndpointTweetLikers:
+		resp, err = s.tweetLikers(id, q)
+	case twitter.EndpointTweetRetweeters:
+		resp, err = s.tweetRetweeters(id, q)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeJSON(w, err.httpStatus(), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// matchFault returns the fault to apply to the current request
+func (s *Server) matchFault(endpoint twitter.Endpoint) *Fault {
+	for _, f := range s.faults {
+		if f.Endpoint != "" && f.Endpoint != endpoint {
+			continue
+		}
+		f.matched++
+		if f.matched <= f.Skip {
+			continue
+		}
+		if f.Times > 0 && f.matched > f.Skip+f.Times {
+			continue
+		}
+		return f
+	}
+	return nil
+}
+
+// checkRateLimit counts the request towards the endpoint limit and returns
+// true when request is over the limit.
+func (s *Server) checkRateLimit(endpoint twitter.Endpoint) (bool, http.Header) {
+	l, ok := s.limits[endpoint]
+	if !ok {
+		return false, nil
+	}
+
+	now := s.Now()
+	if l.windowStart.IsZero() || now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.count = 0
+	}
+	l.count++
+
+	remaining := l.requests - l.count
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := l.windowStart.Add(l.window)
+	// Reset header has second precision, round up so that clients never
+	// retry before the window ends
+	resetUnix := reset.Unix()
+	if reset.After(time.Unix(resetUnix, 0)) {
+		resetUnix++
+	}
+
+	headers := http.Header{}
+	headers.Set("x-rate-limit-limit", strconv.Itoa(l.requests))
+	headers.Set("x-rate-limit-remaining", strconv.Itoa(remaining))
+	headers.Set("x-rate-limit-reset", strconv.FormatInt(resetUnix, 10))
+
+	return l.count > l.requests, headers
+}
+
+// problem is a problem details response body
+type problem struct {
+	Title  string                  `json:"title,omitempty"`
+	Detail string                  `json:"detail,omitempty"`
+	Type   string                  `json:"type,omitempty"`
+	Status int                     `json:"status,omitempty"`
+	Errors []twitter.ProblemDetail `json:"errors,omitempty"`
+}
+
+// httpStatus returns the response status code. Problems without status are
+// partial errors which API returns with HTTP 200.
+func (p *problem) httpStatus() int {
+	if p.Status == 0 {
+		return http.StatusOK
+	}
+	return p.Status
+}
+
+func invalidRequest(message string, parameter string, value string) *problem {
+	return &problem{
+		Title:  "Invalid Request",
+		Detail: "One or more parameters to your request was invalid.",
+		Type:   twitter.ProblemInvalidRequest,
+		Status: http.StatusBadRequest,
+		Errors: []twitter.ProblemDetail{
+			{
+				Message:    message,
+				Parameters: map[string][]string{parameter: {value}},
+			},
+		},
+	}
+}
+
+func writeProblem(w http.ResponseWriter, status int, title, detail, problemType string) {
+	writeJSON(w, status, &problem{Title: title, Detail: detail, Type: problemType, Status: status})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// page is a paginated slice of fixture ids
+type page struct {
+	ids       []string
+	nextToken string
+	prevToken string
+}
+
+func encodePaginationToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodePaginationToken(token string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, false
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), "offset:"))
+	if err != nil || offset < 0 {
+		return 0, false
+	}
+	return offset, true
+}
+
+// paginate applies max_results and pagination_token query parameters to ids
+func paginate(ids []string, q map[string][]string, defaultMax, minMax, maxMax int) (*page, *problem) {
+	max := defaultMax
+	if v := first(q["max_results"]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minMax || n > maxMax {
+			return nil, invalidRequest(
+				fmt.Sprintf("The `max_results` query parameter value [%s] is not between %d and %d", v, minMax, maxMax),
+				"max_results", v,
+			)
+		}
+		max = n
+	}
+
+	offset := 0
+	if v := first(q["pagination_token"]); v != "" {
+		o, ok := decodePaginationToken(v)
+		if !ok {
+			return nil, invalidRequest(
+				fmt.Sprintf("The `pagination_token` query parameter value [%s] is not valid", v),
+				"pagination_token", v,
+			)
+		}
+		offset = o
+	}
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+
+	end := offset + max
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	p := &page{ids: ids[offset:end]}
+	if end < len(ids) {
+		p.nextToken = encodePaginationToken(end)
+	}
+	if offset > 0 {
+		prev := offset - max
+		if prev < 0 {
+			prev = 0
+		}
+		p.prevToken = encodePaginationToken(prev)
+	}
+	return p, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func hasExpansion(q map[string][]string, expansion string) bool {
+	return hasListValue(q, "expansions", expansion)
+}
+
+// hasListValue returns true when comma separated query parameter param
+// contains value
+func hasListValue(q map[string][]string, param, value string) bool {
+	for _, v := range q[param] {
+		for _, e := range strings.Split(v, ",") {
+			if e == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// user returns user id with only the requested optional fields
+func (s *Server) user(id string, q map[string][]string) twitter.UserDetail {
+	u := s.users[id]
+	if !hasListValue(q, "user.fields", "public_metrics") {
+		u.PublicMetrics = nil
+	}
+	return u
+}
+
+// tweet returns tweet id with only the requested optional fields
+func (s *Server) tweet(id string, q map[string][]string) twitter.Tweet {
+	t := s.tweets[id]
+	if !hasListValue(q, "tweet.fields", "public_metrics") {
+		t.PublicMetrics = nil
+	}
+	if !hasListValue(q, "tweet.fields", "entities") {
+		t.Entities = nil
+	}
+	if !hasListValue(q, "tweet.fields", "display_text_range") {
+		t.DisplayTextRange = nil
+	}
+	return t
+}
+
+func (s *Server) userNotFound(id string) *problem {
+	return &problem{
+		Errors: []twitter.ProblemDetail{
+			{
+				Value:        id,
+				Detail:       "Could not find user with id: [" + id + "].",
+				Title:        "Not Found Error",
+				ResourceType: "user",
+				Parameter:    "id",
+				ResourceId:   id,
+				Type:         twitter.ProblemResourceNotFound,
+			},
+		},
+		// API responds with 200 and errors only body for missing users
+	}
+}
+
+func (s *Server) userLookup(usernames string, q map[string][]string) map[string]any {
+	data := []twitter.UserDetail{}
+	errs := []twitter.ProblemDetail{}
+
+	for _, name := range strings.Split(usernames, ",") {
+		found := false
+		for _, u := range s.fixtures.Users {
+			if strings.EqualFold(u.Username, name) {
+				data = append(data, s.user(u.Id, q))
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, twitter.ProblemDetail{
+				Value:        name,
+				Detail:       "Could not find user with usernames: [" + name + "].",
+				Title:        "Not Found Error",
+				ResourceType: "user",
+				Parameter:    "usernames",
+				ResourceId:   name,
+				Type:         twitter.ProblemResourceNotFound,
+			})
+		}
+	}
+
+	resp := map[string]any{}
+	if len(data) > 0 {
+		resp["data"] = data
+	}
+	if len(errs) > 0 {
+		resp["errors"] = errs
+	}
+	return resp
+}
+
+// tweetsResponse builds the tweets endpoint response for given tweet ids with
+// includes requested via expansions
+func (s *Server) tweetsResponse(p *page, q map[string][]string) map[string]any {
+	data := []twitter.Tweet{}
+	includedTweets := []twitter.Tweet{}
+	includedUsers := []twitter.UserDetail{}
+	errs := []twitter.ProblemDetail{}
+
+	seenTweets := map[string]bool{}
+	seenUsers := map[string]bool{}
+	includeUser := func(id string) {
+		if _, ok := s.users[id]; ok && !seenUsers[id] {
+			seenUsers[id] = true
+			includedUsers = append(includedUsers, s.user(id, q))
+		}
+	}
+
+	for _, id := range p.ids {
+		tweet := s.tweet(id, q)
+		data = append(data, tweet)
+
+		if hasExpansion(q, "author_id") {
+			includeUser(tweet.AuthorUserId)
+		}
+		if hasExpansion(q, "in_reply_to_user_id") && tweet.InReplyToUserId != "" {
+			includeUser(tweet.InReplyToUserId)
+		}
+
+		if !hasExpansion(q, "referenced_tweets.id") {
+			continue
+		}
+		for _, ref := range tweet.ReferencedTweets {
+			if _, ok := s.tweets[ref.Id]; !ok {
+				errs = append(errs, twitter.ProblemDetail{
+					Value:        ref.Id,
+					Detail:       "Could not find tweet with referenced_tweets.id: [" + ref.Id + "].",
+					Title:        "Not Found Error",
+					ResourceType: "tweet",
+					Parameter:    "referenced_tweets.id",
+					ResourceId:   ref.Id,
+					Type:         twitter.ProblemResourceNotFound,
+				})
+				continue
+			}
+			refTweet := s.tweet(ref.Id, q)
+			if !seenTweets[ref.Id] {
+				seenTweets[ref.Id] = true
+				includedTweets = append(includedTweets, refTweet)
+			}
+			if hasExpansion(q, "referenced_tweets.id.author_id") {
+				includeUser(refTweet.AuthorUserId)
+			}
+		}
+	}
+
+	meta := map[string]any{"result_count": len(data)}
+	if len(data) > 0 {
+		meta["newest_id"] = data[0].TweetId
+		meta["oldest_id"] = data[len(data)-1].TweetId
+	}
+	if p.nextToken != "" {
+		meta["next_token"] = p.nextToken
+	}
+	if p.prevToken != "" {
+		meta["previous_token"] = p.prevToken
+	}
+
+	resp := map[string]any{"meta": meta}
+	if len(data) > 0 {
+		resp["data"] = data
+	}
+	includes := map[string]any{}
+	if len(includedTweets) > 0 {
+		includes["tweets"] = includedTweets
+	}
+	if len(includedUsers) > 0 {
+		includes["users"] = includedUsers
+	}
+	if len(includes) > 0 {
+		resp["includes"] = includes
+	}
+	if len(errs) > 0 {
+		resp["errors"] = errs
+	}
+	return resp
+}
+
+// usersResponse builds the liking_users/retweeted_by response
+func (s *Server) usersResponse(p *page, q map[string][]string) map[string]any {
+	data := []twitter.UserDetail{}
+	for _, id := range p.ids {
+		data = append(data, s.user(id, q))
+	}
+
+	meta := map[string]any{"result_count": len(data)}
+	if p.nextToken != "" {
+		meta["next_token"] = p.nextToken
+	}
+	if p.prevToken != "" {
+		meta["previous_token"] = p.prevToken
+	}
+
+	resp := map[string]any{"meta": meta}
+	if len(data) > 0 {
+		resp["data"] = data
+	}
+	return resp
+}
+
+func (s *Server) userTweets(userId string, q map[string][]string) (any, *problem) {
+	if _, ok := s.users[userId]; !ok {
+		return nil, s.userNotFound(userId)
+	}
+
+	ids := []string{}
+	for _, t := range s.fixtures.Tweets {
+		if t.AuthorUserId == userId {
+			ids = append(ids, t.TweetId)
+		}
+	}
+
+	p, err := paginate(ids, q, 10, 5, 100)
+	if err != nil {
+		return nil, err
+	}
+	return s.tweetsResponse(p, q), nil
+}
+
+func (s *Server) likedTweets(userId string, q map[string][]string) (any, *problem) {
+	if _, ok := s.users[userId]; !ok {
+		return nil, s.userNotFound(userId)
+	}
+
+	ids := []string{}
+	for _, id := range s.fixtures.Likes[userId] {
+		if _, ok := s.tweets[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+
+	p, err := paginate(ids, q, 100, 10, 100)
+	if err != nil {
+		return nil, err
+	}
+	return s.tweetsResponse(p, q), nil
+}
+
+func (s *Server) tweetLikers(tweetId string, q map[string][]string) (any, *problem) {
+	ids := []string{}
+	for _, u := range s.fixtures.Users {
+		for _, liked := range s.fixtures.Likes[u.Id] {
+			if liked == tweetId {
+				ids = append(ids, u.Id)
+				break
+			}
+		}
+	}
+
+	p, err := paginate(ids, q, 100, 1, 100)
+	if err != nil {
+		return nil, err
+	}
+	return s.usersResponse(p, q), nil
+}
+
+func (s *Server) tweetRetweeters(tweetId string, q map[string][]string) (any, *problem) {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, t := range s.fixtures.Tweets {
+		for _, ref := range t.ReferencedTweets {
+			if ref.Type == twitter.Retweet && ref.Id == tweetId && !seen[t.AuthorUserId] {
+				seen[t.AuthorUserId] = true
+				ids = append(ids, t.AuthorUserId)
+			}
+		}
+	}
+
+	p, err := paginate(ids, q, 100, 1, 100)
+	if err != nil {
+		return nil, err
+	}
+	return s.usersResponse(p, q), nil
+}
@@ -0,0 +1,354 @@
+package twittertest
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFixturesServer(t *testing.T) *Server {
+	f, err := LoadFixtures("testdata/fixtures.json")
+	require.NoError(t, err)
+
+	s := NewServer(f)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// fastRetryPolicy retries without waiting noticeable time
+func fastRetryPolicy() twitter.RetryPolicy {
+	p := twitter.DefaultRetryPolicy()
+	p.InitialBackoff = time.Millisecond
+	p.MaxBackoff = time.Millisecond * 10
+	return p
+}
+
+var (
+	alice = twitter.UserDetail{Id: "200", Name: "Alice", Username: "alice", PublicMetrics: &twitter.UserPublicMetrics{
+		FollowersCount: 15400, FollowingCount: 320, TweetCount: 5120, ListedCount: 42,
+	}}
+	bob = twitter.UserDetail{Id: "300", Name: "Bob", Username: "bob", PublicMetrics: &twitter.UserPublicMetrics{
+		FollowersCount: 87, FollowingCount: 95, TweetCount: 210,
+	}}
+	carol = twitter.UserDetail{Id: "400", Name: "Carol", Username: "carol", PublicMetrics: &twitter.UserPublicMetrics{
+		FollowersCount: 1200000, FollowingCount: 12, TweetCount: 18000, ListedCount: 3100,
+	}}
+)
+
+// expectedSeedInteractions is the interaction graph of the seed user (id 100)
+// in testdata/fixtures.json
+func expectedSeedInteractions() *twitter.UserInteractions {
+	return &twitter.UserInteractions{
+		UserTwitterId: "100",
+		RepliesToOtherUsers: map[string]uint{
+			"200": 3,
+			"300": 1,
+		},
+		RetweetsToOtherUsers: map[string]uint{
+			"200": 1,
+			"300": 1,
+			"400": 1,
+		},
+		UserLikedTweets: map[string]uint{
+			"200": 2,
+			"300": 1,
+			"400": 2,
+		},
+		SkippedReferences: map[string]uint{
+			"resource-not-found": 1,
+		},
+		UserMetrics: map[string]twitter.UserPublicMetrics{
+			"200": *alice.PublicMetrics,
+			"300": *bob.PublicMetrics,
+			"400": *carol.PublicMetrics,
+		},
+		// Tweet 2001 of alice is retweeted and liked
+		TweetMetrics: map[string]twitter.TweetPublicMetrics{
+			"200": {RetweetCount: 4, ReplyCount: 8, LikeCount: 62, BookmarkCount: 2, ImpressionCount: 3600},
+		},
+		Usernames: map[string]string{
+			"200": "alice",
+			"300": "bob",
+			"400": "carol",
+		},
+	}
+}
+
+func newTestAnalyzer(c twitter.Client) *twitter.Analyzer {
+	a := twitter.NewDevAnalyzer(c)
+	a.MaxTweetsPerRequest = 10
+	return a
+}
+
+func TestCreateUserInteractionGraph(t *testing.T) {
+	s := newFixturesServer(t)
+
+	result, err := newTestAnalyzer(s.Client()).CreateUserInteractionGraph("100")
+	require.NoError(t, err)
+
+	assert.Equal(t, expectedSeedInteractions(), result)
+	// 12 timeline tweets are fetched in 2 pages, 5 liked tweets in 1 page
+	assert.Equal(t, 2, s.RequestCount(twitter.EndpointUserTweets))
+	assert.Equal(t, 1, s.RequestCount(twitter.EndpointUserLikedTweets))
+}
+
+func TestCreateUserInteractionGraphRateLimited(t *testing.T) {
+	s := newFixturesServer(t)
+	s.SetRateLimit(twitter.EndpointUserTweets, 1, time.Second)
+
+	result, err := newTestAnalyzer(s.Client()).CreateUserInteractionGraph("100")
+	require.NoError(t, err)
+
+	// Analyzer waits for the reset and continues where it stopped
+	assert.Equal(t, expectedSeedInteractions(), result)
+	assert.Equal(t, 3, s.RequestCount(twitter.EndpointUserTweets))
+}
+
+func TestPagination(t *testing.T) {
+	s := newFixturesServer(t)
+	c := s.Client()
+
+	ids := []string{}
+	opts := []twitter.ApiRequestOption{twitter.OptApplyMaxResults("5")}
+	pages := 0
+	for {
+		resp, err := c.FetchUserTweets("100", opts...)
+		require.NoError(t, err)
+		pages++
+
+		assert.Equal(t, len(resp.Data), resp.Meta.ResultCount)
+		assert.Equal(t, resp.Data[0].TweetId, resp.Meta.NewestID)
+		if pages > 1 {
+			assert.NotEmpty(t, resp.Meta.PreviousToken)
+		}
+		for _, tweet := range resp.Data {
+			ids = append(ids, tweet.TweetId)
+		}
+
+		if resp.Meta.NextToken == "" {
+			break
+		}
+		opts = []twitter.ApiRequestOption{twitter.OptApplyMaxResults("5"), twitter.OptApplyPaginationToken(resp.Meta.NextToken)}
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"1012", "1011", "1010", "1009", "1008", "1007", "1006", "1005", "1004", "1003", "1002", "1001"}, ids)
+}
+
+func TestIncludesAndPartialErrors(t *testing.T) {
+	s := newFixturesServer(t)
+	c := s.Client()
+
+	resp, err := c.FetchUserTweets("100", twitter.OptApplyMaxResults("10"))
+	require.NoError(t, err)
+
+	gm := resp.FindReferencedTweet("2001")
+	require.NotNil(t, gm)
+	assert.Equal(t, &twitter.TweetPublicMetrics{RetweetCount: 2, ReplyCount: 4, LikeCount: 31, BookmarkCount: 1, ImpressionCount: 1800}, gm.PublicMetrics)
+	assert.Contains(t, resp.Includes.Users, alice)
+	assert.NotNil(t, resp.FindReferencedTweet("4001"))
+	assert.Nil(t, resp.FindReferencedTweet("9999"))
+
+	pd := resp.FindResourceError("9999")
+	require.NotNil(t, pd)
+	assert.Equal(t, twitter.ProblemResourceNotFound, pd.Type)
+
+	lookup, err := c.FindUserDetails([]string{"alice", "nobody"})
+	require.NoError(t, err)
+	assert.Equal(t, []twitter.UserDetail{alice}, lookup.Data)
+	require.Len(t, lookup.Errors, 1)
+	assert.Equal(t, "nobody", lookup.Errors[0].Value)
+}
+
+func TestLikersAndRetweeters(t *testing.T) {
+	s := newFixturesServer(t)
+	c := s.Client()
+
+	likers, err := c.FetchTweetLikers("1008")
+	require.NoError(t, err)
+	assert.Equal(t, []twitter.UserDetail{alice, bob}, likers.Data)
+
+	retweeters, err := c.FetchTweetRetweeters("1008")
+	require.NoError(t, err)
+	assert.Equal(t, []twitter.UserDetail{alice}, retweeters.Data)
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newFixturesServer(t)
+	now := time.Unix(1700000000, 0)
+	s.Now = func() time.Time { return now }
+	s.SetRateLimit(twitter.EndpointUserLookup, 2, time.Minute*15)
+
+	c := s.Client()
+	for i := 0; i < 2; i++ {
+		_, err := c.FindUserDetails([]string{"alice"})
+		require.NoError(t, err)
+	}
+
+	_, err := c.FindUserDetails([]string{"alice"})
+	erl := &twitter.ErrRateLimited{}
+	require.ErrorAs(t, err, &erl)
+	assert.Equal(t, now.Add(time.Minute*15).Unix(), erl.ResetTimestamp)
+
+	// Window resets
+	now = now.Add(time.Minute * 15)
+	_, err = c.FindUserDetails([]string{"alice"})
+	require.NoError(t, err)
+}
+
+func TestFaultInjection(t *testing.T) {
+	t.Run("transient faults are retried", func(t *testing.T) {
+		s := newFixturesServer(t)
+		s.InjectFault(Fault{Endpoint: twitter.EndpointUserLookup, Status: http.StatusServiceUnavailable, Times: 2})
+
+		_, err := s.Client(twitter.WithRetryPolicy(fastRetryPolicy())).FindUserDetails([]string{"alice"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, s.RequestCount(twitter.EndpointUserLookup))
+	})
+
+	t.Run("skip and custom body", func(t *testing.T) {
+		s := newFixturesServer(t)
+		s.InjectFault(Fault{
+			Endpoint: twitter.EndpointTweetLikers,
+			Skip:     1,
+			Times:    1,
+			Status:   http.StatusForbidden,
+			Body:     `{"title":"Client Forbidden","reason":"client-not-enrolled","type":"https://api.twitter.com/2/problems/client-forbidden"}`,
+		})
+		c := s.Client()
+
+		_, err := c.FetchTweetLikers("1008")
+		require.NoError(t, err)
+		_, err = c.FetchTweetLikers("1008")
+		assert.True(t, twitter.IsClientNotEnrolled(err))
+		_, err = c.FetchTweetLikers("1008")
+		require.NoError(t, err)
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		s := newFixturesServer(t)
+		s.InjectFault(Fault{Status: http.StatusOK, Body: `{}`, Delay: time.Millisecond * 200})
+
+		_, err := s.Client(
+			twitter.WithTimeout(time.Millisecond*20),
+			twitter.WithRetryPolicy(twitter.NoRetryPolicy()),
+		).FindUserDetails([]string{"alice"})
+		assert.Error(t, err)
+	})
+}
+
+func TestInvalidMaxResults(t *testing.T) {
+	s := newFixturesServer(t)
+
+	_, err := s.Client().FetchUserLikedTweets("100", twitter.OptApplyMaxResults("5"))
+	apiErr := &twitter.ErrAPI{}
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, twitter.ProblemInvalidRequest, apiErr.Type)
+}
+
+func TestCreateUserInteractionGraphReplay(t *testing.T) {
+	s := newFixturesServer(t)
+
+	path := t.TempDir() + "/cassette.json"
+	recorded, err := newTestAnalyzer(s.Client(twitter.WithTransport(twitter.NewRecordingTransport(path)))).
+		CreateUserInteractionGraph("100")
+	require.NoError(t, err)
+	s.Close()
+
+	replay, err := twitter.NewReplayTransportFromFile(path)
+	require.NoError(t, err)
+
+	replayed, err := newTestAnalyzer(s.Client(twitter.WithTransport(replay))).CreateUserInteractionGraph("100")
+	require.NoError(t, err)
+
+	assert.Equal(t, recorded, replayed)
+	assert.Equal(t, 0, replay.Remaining())
+}
+
+func TestCreateUserInteractionGraphFromArchive(t *testing.T) {
+	s := newFixturesServer(t)
+
+	path := t.TempDir() + "/archive.jsonl.gz"
+	archive, err := twitter.CreateArchive(path)
+	require.NoError(t, err)
+	live, err := newTestAnalyzer(twitter.NewArchivingClient(s.Client(), archive)).CreateUserInteractionGraph("100")
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	s.Close()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	replayed, err := twitter.NewReplayAnalyzer().CreateUserInteractionGraph(f, "100")
+	require.NoError(t, err)
+	assert.Equal(t, live, replayed)
+}
+
+func TestInteractionSeriesFromArchive(t *testing.T) {
+	s := newFixturesServer(t)
+
+	path := t.TempDir() + "/archive.jsonl.gz"
+	archive, err := twitter.CreateArchive(path)
+	require.NoError(t, err)
+	live, err := newTestAnalyzer(twitter.NewArchivingClient(s.Client(), archive)).CreateUserInteractionGraph("100")
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	s.Close()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	events, err := twitter.ArchiveEvents(f, "100")
+	require.NoError(t, err)
+
+	// Over the whole fixtures range the series add up to the live counts
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := twitter.InteractionEvents(events).Series(twitter.Weekly, from, from.AddDate(0, 1, 0))
+	for userId, points := range series {
+		sum := twitter.SeriesPoint{}
+		for _, p := range points {
+			sum.Replies += p.Replies
+			sum.Retweets += p.Retweets + p.Quotes
+			sum.Likes += p.Likes
+		}
+		assert.Equal(t, live.RepliesToOtherUsers[userId], sum.Replies, userId)
+		assert.Equal(t, live.RetweetsToOtherUsers[userId], sum.Retweets, userId)
+		assert.Equal(t, live.UserLikedTweets[userId], sum.Likes, userId)
+	}
+	assert.Len(t, series, len(live.RankedUsers()))
+}
+
+func TestCrawlEgoNetwork(t *testing.T) {
+	s := newFixturesServer(t)
+
+	crawler := twitter.NewCrawler(newTestAnalyzer(s.Client()))
+	crawler.Breadth = 2
+	crawler.CheckpointPath = t.TempDir() + "/crawl.json"
+	result, err := crawler.Crawl(context.Background(), "100")
+	require.NoError(t, err)
+
+	// 300 and 400 are tied after 200, the lower id is crawled
+	assert.Equal(t, map[string]int{"100": 0, "200": 1, "300": 1}, result.Crawled)
+	assert.Equal(t, []string{"100", "200", "300", "400"}, result.Graph.NodeIds())
+	assert.Equal(t, []twitter.GraphEdge{
+		{From: "200", To: "100", Kind: twitter.InteractionLike, Count: 2},
+		{From: "200", To: "100", Kind: twitter.InteractionRetweet, Count: 1},
+		{From: "300", To: "100", Kind: twitter.InteractionLike, Count: 1},
+	}, result.Graph.InEdges("100"))
+	assert.Equal(t, "alice", result.Graph.Node("200").Username)
+	requests := s.RequestCount(twitter.EndpointUserTweets)
+
+	// Resumed crawl is served from the checkpoint
+	resumed, err := crawler.Crawl(context.Background(), "100")
+	require.NoError(t, err)
+	assert.Equal(t, result.Graph.Edges(), resumed.Graph.Edges())
+	assert.Equal(t, requests, s.RequestCount(twitter.EndpointUserTweets))
+}
@@ -0,0 +1,300 @@
+package twittertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+)
+
+// defaultKeepAlive is the heartbeat interval of the real API
+const defaultKeepAlive = time.Second * 20
+
+// streamConn is a single connected stream client
+type streamConn struct {
+	endpoint twitter.Endpoint
+	query    map[string][]string
+	messages chan []byte
+	closed   chan struct{}
+}
+
+// StreamClient creates a bearer token stream client pointed at the server.
+func (s *Server) StreamClient(options ...twitter.ClientOption) twitter.StreamClient {
+	return twitter.NewAuthBearerClient("twittertest-token",
+		append([]twitter.ClientOption{twitter.WithBaseURL(s.BaseURL())}, options...)...,
+	)
+}
+
+// PushTweet adds tweet to the fixtures and delivers it to connected filtered
+// stream clients when it matches at least one stream rule. Rules support
+// "from:<user id or username>" terms and plain keywords, all terms of a rule
+// must match. Sampled stream clients receive every pushed tweet. Tweets pushed
+// while no client is connected are lost, the same as with the real API.
+func (s *Server) PushTweet(tweet twitter.Tweet) {
+	s.mu.Lock()
+	s.tweets[tweet.TweetId] = tweet
+
+	matching := []twitter.MatchingRule{}
+	for _, rule := range s.rules {
+		if s.ruleMatches(rule, tweet) {
+			matching = append(matching, twitter.MatchingRule{Id: rule.Id, Tag: rule.Tag})
+		}
+	}
+
+	messages := map[*streamConn][]byte{}
+	for conn := range s.streams {
+		filtered := conn.endpoint == twitter.EndpointSearchStream
+		if filtered && len(matching) == 0 {
+			continue
+		}
+		resp := s.tweetsResponse(&page{ids: []string{tweet.TweetId}}, conn.query)
+		msg := map[string]any{
+			"data": resp["data"].([]twitter.Tweet)[0],
+		}
+		if filtered {
+			msg["matching_rules"] = matching
+		}
+		if includes, ok := resp["includes"]; ok {
+			msg["includes"] = includes
+		}
+		if errs, ok := resp["errors"]; ok {
+			msg["errors"] = errs
+		}
+		messages[conn], _ = json.Marshal(msg)
+	}
+	s.mu.Unlock()
+
+	for conn, msg := range messages {
+		conn.send(msg)
+	}
+}
+
+// SendStreamMessage sends a raw message line, for example an
+// operational-disconnect error, to all connected stream clients.
+func (s *Server) SendStreamMessage(message string) {
+	for _, conn := range s.streamConns() {
+		conn.send([]byte(message))
+	}
+}
+
+// streamConns returns the currently connected stream clients
+func (s *Server) streamConns() []*streamConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := make([]*streamConn, 0, len(s.streams))
+	for conn := range s.streams {
+		ret = append(ret, conn)
+	}
+	return ret
+}
+
+// send queues msg without holding the server lock, so that a slow client does
+// not block the server. Messages to disconnected clients are dropped.
+func (c *streamConn) send(msg []byte) {
+	select {
+	case c.messages <- msg:
+	case <-c.closed:
+	}
+}
+
+// StreamConnections returns the number of connected stream clients.
+func (s *Server) StreamConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.streams)
+}
+
+// DisconnectStreams drops all stream connections.
+func (s *Server) DisconnectStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.streams {
+		close(conn.closed)
+		delete(s.streams, conn)
+	}
+}
+
+// Close drops the stream connections and shuts down the server.
+func (s *Server) Close() {
+	s.DisconnectStreams()
+	s.Server.Close()
+}
+
+func (s *Server) ruleMatches(rule twitter.StreamRule, tweet twitter.Tweet) bool {
+	author := s.users[tweet.AuthorUserId]
+	for _, term := range strings.Fields(rule.Value) {
+		if from, ok := strings.CutPrefix(term, "from:"); ok {
+			if from != tweet.AuthorUserId && !strings.EqualFold(from, author.Username) {
+				return false
+			}
+			continue
+		}
+		if !strings.Contains(strings.ToLower(tweet.TweetText), strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// serveStream keeps the connection open and writes newline delimited tweets
+// and keep-alive heartbeats until the client or the server disconnects.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, endpoint twitter.Endpoint, q map[string][]string) {
+	conn := &streamConn{
+		endpoint: endpoint,
+		query:    q,
+		messages: make(chan []byte, 100),
+		closed:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.streams[conn] = true
+	keepAlive := s.KeepAlive
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		// Not yet closed by DisconnectStreams, unblock pending sends
+		if s.streams[conn] {
+			delete(s.streams, conn)
+			close(conn.closed)
+		}
+		s.mu.Unlock()
+	}()
+
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAlive
+	}
+	heartbeat := time.NewTicker(keepAlive)
+	defer heartbeat.Stop()
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-conn.closed:
+			return
+		case msg := <-conn.messages:
+			w.Write(append(msg, '\r', '\n'))
+		case <-heartbeat.C:
+			w.Write([]byte("\r\n"))
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// streamRulesRequest is the body of the stream rules POST request
+type streamRulesRequest struct {
+	Add    []twitter.StreamRule `json:"add"`
+	Delete *struct {
+		Ids []string `json:"ids"`
+	} `json:"delete"`
+}
+
+// serveStreamRules lists, adds and deletes filtered stream rules
+func (s *Server) serveStreamRules(w http.ResponseWriter, r *http.Request, q map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meta := map[string]any{"sent": s.Now().UTC().Format(time.RFC3339Nano)}
+	resp := map[string]any{"meta": meta}
+
+	if r.Method == http.MethodGet {
+		if len(s.rules) > 0 {
+			resp["data"] = s.rules
+		}
+		meta["result_count"] = len(s.rules)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	req := streamRulesRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Add == nil && req.Delete == nil) {
+		writeJSON(w, http.StatusBadRequest, invalidRequest("Rules request must contain add or delete", "body", ""))
+		return
+	}
+	dryRun := hasListValue(q, "dry_run", "true")
+	errs := []twitter.ProblemDetail{}
+
+	if req.Delete != nil {
+		deleted := 0
+		for _, id := range req.Delete.Ids {
+			found := false
+			for i, rule := range s.rules {
+				if rule.Id == id {
+					found = true
+					if !dryRun {
+						s.rules = append(s.rules[:i], s.rules[i+1:]...)
+					}
+					break
+				}
+			}
+			if found {
+				deleted++
+			} else {
+				errs = append(errs, twitter.ProblemDetail{Value: id, Title: "RuleNotFound"})
+			}
+		}
+		meta["summary"] = map[string]any{"deleted": deleted, "not_deleted": len(req.Delete.Ids) - deleted}
+		if len(errs) > 0 {
+			resp["errors"] = errs
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	created := []twitter.StreamRule{}
+	for _, rule := range req.Add {
+		if strings.TrimSpace(rule.Value) == "" {
+			errs = append(errs, twitter.ProblemDetail{Value: rule.Value, Title: "InvalidRule"})
+			continue
+		}
+		duplicate := false
+		for _, existing := range append(s.rules, created...) {
+			if existing.Value == rule.Value {
+				duplicate = true
+				errs = append(errs, twitter.ProblemDetail{Value: rule.Value, Id: existing.Id, Title: "DuplicateRule"})
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		s.nextRuleId++
+		created = append(created, twitter.StreamRule{
+			Id:    strconv.Itoa(1000 + s.nextRuleId),
+			Value: rule.Value,
+			Tag:   rule.Tag,
+		})
+	}
+	if !dryRun {
+		s.rules = append(s.rules, created...)
+	}
+
+	summary := map[string]any{"valid": len(created), "invalid": len(req.Add) - len(created)}
+	if !dryRun {
+		summary["created"] = len(created)
+		summary["not_created"] = len(req.Add) - len(created)
+	}
+	meta["summary"] = summary
+	if len(created) > 0 {
+		resp["data"] = created
+	}
+	if len(errs) > 0 {
+		resp["errors"] = errs
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,295 @@
+package twittertest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/D8-X/twitter-counter/src/twitter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRules(t *testing.T) {
+	s := newFixturesServer(t)
+	c := s.StreamClient()
+
+	// Dry run validates without creating
+	resp, err := c.AddStreamRules([]twitter.StreamRule{{Value: "from:seed", Tag: "seed"}}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.Meta.Summary.Valid)
+	rules, err := c.GetStreamRules()
+	require.NoError(t, err)
+	assert.Empty(t, rules.Data)
+
+	resp, err = c.AddStreamRules([]twitter.StreamRule{
+		{Value: "from:seed", Tag: "seed"},
+		{Value: "gm"},
+		{Value: "from:seed"},
+	}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.Meta.Summary.Created)
+	assert.Equal(t, 1, resp.Meta.Summary.NotCreated)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "DuplicateRule", resp.Errors[0].Title)
+
+	rules, err = c.GetStreamRules()
+	require.NoError(t, err)
+	assert.Equal(t, resp.Data, rules.Data)
+
+	deleted, err := c.DeleteStreamRules([]string{rules.Data[1].Id}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted.Meta.Summary.Deleted)
+
+	rules, err = c.GetStreamRules()
+	require.NoError(t, err)
+	assert.Equal(t, []twitter.StreamRule{{Id: resp.Data[0].Id, Value: "from:seed", Tag: "seed"}}, rules.Data)
+}
+
+// fastStreamReconnect reconnects without waiting noticeable time
+func fastStreamReconnect() twitter.StreamReconnectPolicy {
+	return twitter.StreamReconnectPolicy{
+		NetworkStep:      time.Millisecond,
+		NetworkMax:       time.Millisecond * 10,
+		HTTPInitial:      time.Millisecond,
+		HTTPMax:          time.Millisecond * 10,
+		RateLimitInitial: time.Millisecond,
+		RateLimitMax:     time.Millisecond * 10,
+	}
+}
+
+func TestFilteredStreamInteractions(t *testing.T) {
+	s := newFixturesServer(t)
+	s.KeepAlive = time.Millisecond * 10
+	c := s.StreamClient()
+
+	_, err := c.AddStreamRules([]twitter.StreamRule{{Value: "from:100", Tag: "seed"}}, false)
+	require.NoError(t, err)
+
+	// Reconnects after a failed connection
+	s.InjectFault(Fault{Endpoint: twitter.EndpointSearchStream, Status: http.StatusServiceUnavailable, Times: 1})
+
+	stream := twitter.NewFilteredStream(c)
+	stream.Reconnect = fastStreamReconnect()
+	stream.StallTimeout = time.Millisecond * 200
+
+	updater := twitter.NewInteractionUpdater("100", nil)
+	received := make(chan *twitter.StreamTweet, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- stream.Run(ctx, func(tweet *twitter.StreamTweet) error {
+			received <- tweet
+			return updater.HandleTweet(tweet)
+		})
+	}()
+
+	waitForStream := func() {
+		require.Eventually(t, func() bool { return s.StreamConnections() == 1 }, time.Second*5, time.Millisecond*5)
+	}
+	nextTweet := func() *twitter.StreamTweet {
+		select {
+		case tweet := <-received:
+			return tweet
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "no tweet received")
+			return nil
+		}
+	}
+
+	waitForStream()
+	s.PushTweet(twitter.Tweet{TweetId: "5001", AuthorUserId: "100", TweetText: "@alice hi", InReplyToUserId: "200", ConversationTweetId: "2001"})
+	// Not matching any rule
+	s.PushTweet(twitter.Tweet{TweetId: "5002", AuthorUserId: "300", TweetText: "unrelated"})
+	s.PushTweet(twitter.Tweet{TweetId: "5003", AuthorUserId: "100", TweetText: "RT @carol", ReferencedTweets: []twitter.ReferencedTweetMeta{{Type: twitter.Retweet, Id: "4001"}}})
+
+	first := nextTweet()
+	assert.Equal(t, "5001", first.Data.TweetId)
+	assert.Equal(t, []twitter.MatchingRule{{Id: first.MatchingRules[0].Id, Tag: "seed"}}, first.MatchingRules)
+	second := nextTweet()
+	assert.Equal(t, "5003", second.Data.TweetId)
+	assert.NotNil(t, second.Includes.Users)
+
+	// Dropped connection is reconnected and counting continues
+	s.DisconnectStreams()
+	waitForStream()
+	s.PushTweet(twitter.Tweet{TweetId: "5004", AuthorUserId: "100", TweetText: "@bob yes", InReplyToUserId: "300"})
+	assert.Equal(t, "5004", nextTweet().Data.TweetId)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	snapshot := updater.Snapshot()
+	assert.Equal(t, map[string]uint{"200": 1, "300": 1}, snapshot.RepliesToOtherUsers)
+	assert.Equal(t, map[string]uint{"400": 1}, snapshot.RetweetsToOtherUsers)
+	assert.Equal(t, "carol", snapshot.Usernames["400"])
+	assert.GreaterOrEqual(t, s.RequestCount(twitter.EndpointSearchStream), 3)
+}
+
+func TestRuleManagerSyncAndMatches(t *testing.T) {
+	s := newFixturesServer(t)
+	c := s.StreamClient()
+
+	_, err := c.AddStreamRules([]twitter.StreamRule{{Value: "gm", Tag: "greetings"}, {Value: "from:carol", Tag: "old"}}, false)
+	require.NoError(t, err)
+
+	desired := []twitter.StreamRule{
+		{Value: "from:carol", Tag: "carol"},
+		{Value: "d8x", Tag: "campaign"},
+	}
+	m := twitter.NewRuleManager(c)
+
+	dry, err := m.Sync(desired, true)
+	require.NoError(t, err)
+	assert.Len(t, dry.Added, 2)
+	assert.Len(t, dry.Deleted, 2)
+	rules, err := c.GetStreamRules()
+	require.NoError(t, err)
+	assert.Len(t, rules.Data, 2)
+	assert.Equal(t, "greetings", rules.Data[0].Tag)
+
+	result, err := m.Sync(desired, false)
+	require.NoError(t, err)
+	assert.Len(t, result.Added, 2)
+	rules, err = c.GetStreamRules()
+	require.NoError(t, err)
+	assert.Equal(t, result.Added, rules.Data)
+
+	// Second sync is a no-op
+	result, err = m.Sync(desired, false)
+	require.NoError(t, err)
+	assert.False(t, result.Changed())
+
+	counter := twitter.NewRuleMatchCounter()
+	received := make(chan struct{}, 10)
+	stream := twitter.NewFilteredStream(c)
+	stream.Reconnect = fastStreamReconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- stream.Run(ctx, twitter.StreamHandlers(counter.HandleTweet, func(*twitter.StreamTweet) error {
+			received <- struct{}{}
+			return nil
+		}))
+	}()
+	require.Eventually(t, func() bool { return s.StreamConnections() == 1 }, time.Second*5, time.Millisecond*5)
+
+	s.PushTweet(twitter.Tweet{TweetId: "6001", AuthorUserId: "400", TweetText: "trading on D8X"})
+	s.PushTweet(twitter.Tweet{TweetId: "6002", AuthorUserId: "200", TweetText: "d8x gm"})
+	s.PushTweet(twitter.Tweet{TweetId: "6003", AuthorUserId: "200", TweetText: "gm"})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "no tweet received")
+		}
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, map[string]uint{"carol": 1, "campaign": 2}, counter.Counts())
+}
+
+func TestSampledStreamFrequencies(t *testing.T) {
+	s := newFixturesServer(t)
+	s.KeepAlive = time.Millisecond * 10
+	c := s.StreamClient()
+
+	// Sampled stream is not filtered by rules
+	_, err := c.AddStreamRules([]twitter.StreamRule{{Value: "from:nobody"}}, false)
+	require.NoError(t, err)
+
+	freq := twitter.NewFrequencyAggregator(0)
+	received := make(chan *twitter.StreamTweet, 10)
+	stream := twitter.NewSampledStream(c)
+	stream.Reconnect = fastStreamReconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- stream.Run(ctx, twitter.StreamHandlers(freq.HandleTweet, func(tweet *twitter.StreamTweet) error {
+			received <- tweet
+			return nil
+		}))
+	}()
+	require.Eventually(t, func() bool { return s.StreamConnections() == 1 }, time.Second*5, time.Millisecond*5)
+
+	s.PushTweet(twitter.Tweet{TweetId: "7001", AuthorUserId: "200", TweetText: "#DeFi with @carol", Entities: &twitter.TweetEntities{
+		Hashtags: []twitter.HashtagEntity{{Start: 0, End: 5, Tag: "DeFi"}},
+		Mentions: []twitter.MentionEntity{{Start: 11, End: 17, Username: "carol"}},
+	}})
+	s.PushTweet(twitter.Tweet{TweetId: "7002", AuthorUserId: "300", TweetText: "#defi", Entities: &twitter.TweetEntities{
+		Hashtags: []twitter.HashtagEntity{{Start: 0, End: 5, Tag: "defi"}},
+	}})
+	for i := 0; i < 2; i++ {
+		select {
+		case tweet := <-received:
+			assert.Empty(t, tweet.MatchingRules)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "no tweet received")
+		}
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	snap := freq.Snapshot(0)
+	assert.Equal(t, uint(2), snap.Tweets)
+	require.Len(t, snap.Hashtags, 1)
+	assert.Equal(t, twitter.FrequencyEntry{Key: "defi", Count: 2, Share: 1, Estimated: 200, EstimatedPerHour: snap.Hashtags[0].EstimatedPerHour}, snap.Hashtags[0])
+	assert.Equal(t, "carol", snap.Mentions[0].Key)
+	assert.Equal(t, 1, s.RequestCount(twitter.EndpointSampleStream))
+}
+
+func TestPushTweetToBlockedClient(t *testing.T) {
+	s := newFixturesServer(t)
+
+	// Client which does not read its messages
+	conn := &streamConn{
+		endpoint: twitter.EndpointSampleStream,
+		messages: make(chan []byte),
+		closed:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.streams[conn] = true
+	s.mu.Unlock()
+
+	pushed := make(chan struct{})
+	go func() {
+		s.PushTweet(twitter.Tweet{TweetId: "9001", AuthorUserId: "100", TweetText: "blocked"})
+		close(pushed)
+	}()
+
+	// Server stays responsive while the push waits for the client
+	_, err := s.Client().FetchUserTweets("100")
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.StreamConnections())
+
+	s.DisconnectStreams()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("push to disconnected client did not return")
+	}
+}
+
+func TestPushTweetWhileServing(t *testing.T) {
+	s := newFixturesServer(t)
+	c := s.Client()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			s.PushTweet(twitter.Tweet{TweetId: strconv.Itoa(9000 + i), AuthorUserId: "100", TweetText: "pushed"})
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := c.FetchUserTweets("100")
+		require.NoError(t, err)
+	}
+	<-done
+}